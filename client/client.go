@@ -14,9 +14,12 @@ const (
 	passdbDir  = ".yanpassword"
 	passdbFile = "db.bin"
 
-	maxBackups = 5
+	attachmentsDir = "attachments"
 )
 
+// MaxBackups is the number of previous passdb files kept on every save
+const MaxBackups = 5
+
 // CheckAuth checks auth with a dummy yandex webdav request
 func CheckAuth(username string, password string) error {
 	cli := gowebdav.NewClient(webdavURL, username, password)
@@ -46,6 +49,42 @@ func (pdbc *PassdbClient) Load() ([]byte, error) {
 	return data, err
 }
 
+// Filenames returns the main passdb file name followed by backup file names
+func (pdbc *PassdbClient) Filenames() []string {
+	filename := path.Join(passdbDir, passdbFile)
+	names := []string{filename}
+	for i := 1; i <= MaxBackups; i++ {
+		names = append(names, fmt.Sprintf("%s.%d", filename, i))
+	}
+	return names
+}
+
+// LoadFile loads a passdb or a backup file by its name
+func (pdbc *PassdbClient) LoadFile(filename string) ([]byte, error) {
+	return pdbc.cli.Read(filename)
+}
+
+// LoadAttachment loads an attachment blob by its id
+func (pdbc *PassdbClient) LoadAttachment(id string) ([]byte, error) {
+	return pdbc.cli.Read(path.Join(passdbDir, attachmentsDir, id))
+}
+
+// SaveAttachment saves an attachment blob. Blobs are never overwritten,
+// a changed attachment gets a new blob.
+func (pdbc *PassdbClient) SaveAttachment(id string, data []byte) error {
+	dir := path.Join(passdbDir, attachmentsDir)
+	err := pdbc.cli.MkdirAll(dir, os.FileMode(0755))
+	if err != nil {
+		return err
+	}
+	return pdbc.cli.Write(path.Join(dir, id), data, os.FileMode(0644))
+}
+
+// DeleteAttachment removes an attachment blob, a missing blob is not an error
+func (pdbc *PassdbClient) DeleteAttachment(id string) error {
+	return pdbc.cli.Remove(path.Join(passdbDir, attachmentsDir, id))
+}
+
 // Is404 tries to figure out if the error is a 404 not found error
 func Is404(err error) bool {
 	if err == nil {
@@ -69,7 +108,7 @@ func (pdbc *PassdbClient) Save(data []byte) error {
 
 	filename := path.Join(passdbDir, passdbFile)
 	fmt.Printf("Creating backups")
-	for i := maxBackups - 1; i > 0; i-- {
+	for i := MaxBackups - 1; i > 0; i-- {
 		prev = fmt.Sprintf("%s.%d", filename, i)
 		next = fmt.Sprintf("%s.%d", filename, i+1)
 
@@ -0,0 +1,390 @@
+// Package clipboard puts secrets on the system clipboard and takes them
+// off after a timeout unless the clipboard has been changed since
+package clipboard
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/viert/yanpassword/secmem"
+)
+
+// Provider names
+const (
+	ProviderOSC52  = "osc52"
+	ProviderWlCopy = "wl-copy"
+	ProviderXClip  = "xclip"
+	ProviderXSel   = "xsel"
+)
+
+// ErrUnsupported is returned by providers unable to read the clipboard
+var ErrUnsupported = errors.New("reading the clipboard is not supported")
+
+// Provider is a way to access the system clipboard
+type Provider interface {
+	Name() string
+	Write(data []byte) error
+	// Read returns the clipboard contents or ErrUnsupported
+	Read() ([]byte, error)
+	// Readable returns false if Read always fails with ErrUnsupported
+	Readable() bool
+	Clear() error
+}
+
+// Detect returns the first provider available in the environment: wl-copy
+// under Wayland, xclip or xsel under X11 and OSC 52 terminal escapes otherwise
+func Detect() (Provider, error) {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if p, err := New(ProviderWlCopy); err == nil {
+			return p, nil
+		}
+	}
+	if os.Getenv("DISPLAY") != "" {
+		for _, name := range []string{ProviderXClip, ProviderXSel} {
+			if p, err := New(name); err == nil {
+				return p, nil
+			}
+		}
+	}
+	return New(ProviderOSC52)
+}
+
+// New returns the provider by its name
+func New(name string) (Provider, error) {
+	var p *command
+	switch name {
+	case ProviderOSC52:
+		return newOSC52()
+	case ProviderWlCopy:
+		p = &command{
+			name:  name,
+			write: []string{"wl-copy"},
+			read:  []string{"wl-paste", "--no-newline"},
+			clear: []string{"wl-copy", "--clear"},
+			empty: []string{"Nothing is copied", "No selection"},
+		}
+	case ProviderXClip:
+		p = &command{
+			name:  name,
+			write: []string{"xclip", "-selection", "clipboard"},
+			read:  []string{"xclip", "-selection", "clipboard", "-out"},
+			clear: []string{"xclip", "-selection", "clipboard", "/dev/null"},
+			empty: []string{"target STRING not available", "target UTF8_STRING not available"},
+		}
+	case ProviderXSel:
+		p = &command{
+			name:  name,
+			write: []string{"xsel", "--clipboard", "--input"},
+			read:  []string{"xsel", "--clipboard", "--output"},
+			clear: []string{"xsel", "--clipboard", "--delete"},
+		}
+	default:
+		return nil, fmt.Errorf("unknown clipboard provider %s", name)
+	}
+
+	for _, args := range [][]string{p.write, p.read, p.clear} {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// command is a provider running clipboard tools
+type command struct {
+	name  string
+	write []string
+	read  []string
+	clear []string
+	// empty are the messages the read tool fails with if the clipboard is empty
+	empty []string
+}
+
+func (c *command) Name() string {
+	return c.name
+}
+
+// commandError is a failure of a clipboard tool along with its error output
+type commandError struct {
+	tool   string
+	err    error
+	stderr string
+}
+
+func (e *commandError) Error() string {
+	if e.stderr != "" {
+		return fmt.Sprintf("%s: %s: %s", e.tool, e.err, e.stderr)
+	}
+	return fmt.Sprintf("%s: %s", e.tool, e.err)
+}
+
+func (c *command) run(args []string, stdin []byte, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return &commandError{tool: args[0], err: err, stderr: strings.TrimSpace(stderr.String())}
+	}
+	return nil
+}
+
+// isEmpty checks if the read tool failed because the clipboard is empty
+func (c *command) isEmpty(err error) bool {
+	cerr, ok := err.(*commandError)
+	if !ok {
+		return false
+	}
+	if _, exited := cerr.err.(*exec.ExitError); !exited {
+		return false
+	}
+	for _, msg := range c.empty {
+		if strings.Contains(cerr.stderr, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *command) Write(data []byte) error {
+	return c.run(c.write, data, nil)
+}
+
+func (c *command) Read() ([]byte, error) {
+	var out bytes.Buffer
+	err := c.run(c.read, nil, &out)
+	if c.isEmpty(err) {
+		return nil, nil
+	}
+	if err != nil {
+		secmem.Wipe(out.Bytes())
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (c *command) Readable() bool {
+	return true
+}
+
+func (c *command) Clear() error {
+	return c.run(c.clear, nil, nil)
+}
+
+// osc52 asks the terminal to set the clipboard, it works over ssh
+// as well but the clipboard can't be read back
+type osc52 struct {
+	tmux bool
+}
+
+const ttyPath = "/dev/tty"
+
+func newOSC52() (*osc52, error) {
+	// the terminal is opened for every write so that
+	// no descriptor is kept open in between
+	tty, err := os.OpenFile(ttyPath, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	tty.Close()
+	return &osc52{tmux: os.Getenv("TMUX") != ""}, nil
+}
+
+func (o *osc52) Name() string {
+	return ProviderOSC52
+}
+
+func (o *osc52) Write(data []byte) error {
+	seq := []byte("\x1b]52;c;" + base64.StdEncoding.EncodeToString(data) + "\x07")
+	defer secmem.Wipe(seq)
+	if o.tmux {
+		// tmux passes the sequence through to the outer terminal
+		// with every escape character doubled
+		wrapped := append([]byte("\x1bPtmux;"), bytes.Replace(seq, []byte("\x1b"), []byte("\x1b\x1b"), -1)...)
+		wrapped = append(wrapped, "\x1b\\"...)
+		defer secmem.Wipe(wrapped)
+		seq = wrapped
+	}
+	tty, err := os.OpenFile(ttyPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	_, err = tty.Write(seq)
+	return err
+}
+
+func (o *osc52) Read() ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func (o *osc52) Readable() bool {
+	return false
+}
+
+func (o *osc52) Clear() error {
+	return o.Write(nil)
+}
+
+// Memory is a provider keeping the clipboard in memory, it's meant for tests
+type Memory struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// Name returns the provider name
+func (m *Memory) Name() string {
+	return "memory"
+}
+
+// Write sets the clipboard contents
+func (m *Memory) Write(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = append([]byte{}, data...)
+	return nil
+}
+
+// Read returns the clipboard contents
+func (m *Memory) Read() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]byte{}, m.data...), nil
+}
+
+// Readable returns true, the memory clipboard can be read
+func (m *Memory) Readable() bool {
+	return true
+}
+
+// Clear empties the clipboard
+func (m *Memory) Clear() error {
+	return m.Write(nil)
+}
+
+// Clipboard copies values clearing them after a timeout
+type Clipboard struct {
+	provider Provider
+	mu       sync.Mutex
+	value    []byte
+	timer    *time.Timer
+	// copies counts copied values so that a timer firing
+	// late doesn't clear the value copied after it
+	copies int
+	// ClearUnverified allows clearing the clipboard of providers unable
+	// to read it back, whatever it holds by then
+	ClearUnverified bool
+	// OnClear is called when the clipboard is cleared by the timer,
+	// cleared is false if the clipboard had been changed since
+	OnClear func(cleared bool, err error)
+}
+
+// NewClipboard creates a clipboard using the provider
+func NewClipboard(p Provider) *Clipboard {
+	return &Clipboard{provider: p}
+}
+
+// Provider returns the clipboard provider
+func (c *Clipboard) Provider() Provider {
+	return c.provider
+}
+
+// Copy puts the value on the clipboard, it's cleared after the timeout
+// if the clipboard still holds it. A zero timeout never clears it, neither
+// do providers unable to read the clipboard unless ClearUnverified is set.
+func (c *Clipboard) Copy(value []byte, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.forget()
+	c.copies++
+	err := c.provider.Write(value)
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 || !c.provider.Readable() && !c.ClearUnverified {
+		return nil
+	}
+
+	c.value = append([]byte{}, value...)
+	copies := c.copies
+	c.timer = time.AfterFunc(timeout, func() {
+		c.mu.Lock()
+		if copies != c.copies {
+			c.mu.Unlock()
+			return
+		}
+		cleared, err := c.clear()
+		c.mu.Unlock()
+		if c.OnClear != nil {
+			c.OnClear(cleared, err)
+		}
+	})
+	return nil
+}
+
+// Pending returns true if a value is waiting to be cleared
+func (c *Clipboard) Pending() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value != nil
+}
+
+// Clear clears the copied value right away if the clipboard still holds it.
+// Providers unable to read the clipboard clear it only if ClearUnverified is set.
+func (c *Clipboard) Clear() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clear()
+}
+
+// clear does the job of Clear, c.mu must be held
+func (c *Clipboard) clear() (bool, error) {
+	if c.value == nil {
+		return false, nil
+	}
+	defer c.forget()
+
+	current, err := c.provider.Read()
+	if err != nil && err != ErrUnsupported {
+		return false, err
+	}
+	if err == ErrUnsupported && !c.ClearUnverified {
+		return false, nil
+	}
+	if err == nil {
+		defer secmem.Wipe(current)
+		if subtle.ConstantTimeCompare(current, c.value) != 1 {
+			return false, nil
+		}
+	}
+
+	err = c.provider.Clear()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// forget stops the timer and wipes the copied value, c.mu must be held
+func (c *Clipboard) forget() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	secmem.Wipe(c.value)
+	c.value = nil
+}
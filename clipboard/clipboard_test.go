@@ -0,0 +1,253 @@
+package clipboard
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type clearResult struct {
+	cleared bool
+	err     error
+}
+
+// unreadable is a memory clipboard which can't be read back like OSC 52
+type unreadable struct {
+	Memory
+}
+
+func (u *unreadable) Read() ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func (u *unreadable) Readable() bool {
+	return false
+}
+
+func newTestClipboard(p Provider) (*Clipboard, chan clearResult) {
+	results := make(chan clearResult, 1)
+	c := NewClipboard(p)
+	c.OnClear = func(cleared bool, err error) {
+		results <- clearResult{cleared, err}
+	}
+	return c, results
+}
+
+func waitClear(t *testing.T, results chan clearResult) clearResult {
+	t.Helper()
+	select {
+	case res := <-results:
+		return res
+	case <-time.After(time.Second):
+		t.Fatal("the clipboard timer hasn't fired")
+	}
+	return clearResult{}
+}
+
+func contents(t *testing.T, p Provider) string {
+	t.Helper()
+	data, err := p.Read()
+	if err != nil {
+		t.Fatalf("error reading the clipboard: %s", err)
+	}
+	return string(data)
+}
+
+func TestCopyClearedAfterTimeout(t *testing.T) {
+	p := new(Memory)
+	c, results := newTestClipboard(p)
+
+	err := c.Copy([]byte("secret"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(t, p); got != "secret" {
+		t.Fatalf("clipboard holds %q after copying, want %q", got, "secret")
+	}
+	if !c.Pending() {
+		t.Fatal("the copied value isn't pending")
+	}
+
+	res := waitClear(t, results)
+	if res.err != nil || !res.cleared {
+		t.Fatalf("OnClear(%v, %v), want OnClear(true, nil)", res.cleared, res.err)
+	}
+	if got := contents(t, p); got != "" {
+		t.Fatalf("clipboard holds %q after the timeout, want it empty", got)
+	}
+	if c.Pending() {
+		t.Fatal("the value is still pending after clearing")
+	}
+}
+
+func TestCopyChangedLeftIntact(t *testing.T) {
+	p := new(Memory)
+	c, results := newTestClipboard(p)
+
+	err := c.Copy([]byte("secret"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another application takes over the clipboard
+	p.Write([]byte("something else"))
+
+	res := waitClear(t, results)
+	if res.err != nil || res.cleared {
+		t.Fatalf("OnClear(%v, %v), want OnClear(false, nil)", res.cleared, res.err)
+	}
+	if got := contents(t, p); got != "something else" {
+		t.Fatalf("clipboard holds %q, want it left intact", got)
+	}
+}
+
+func TestStaleTimerKeepsNewerCopy(t *testing.T) {
+	p := new(Memory)
+	c, results := newTestClipboard(p)
+
+	err := c.Copy([]byte("first"), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hold the lock until the first timer has fired and is waiting for it,
+	// then copy the next value the way Copy does so that the timer can't
+	// be stopped anymore
+	c.mu.Lock()
+	time.Sleep(20 * time.Millisecond)
+	c.forget()
+	c.copies++
+	p.Write([]byte("second"))
+	c.value = []byte("second")
+	c.mu.Unlock()
+
+	select {
+	case res := <-results:
+		t.Fatalf("stale timer called OnClear(%v, %v)", res.cleared, res.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := contents(t, p); got != "second" {
+		t.Fatalf("clipboard holds %q, want %q", got, "second")
+	}
+	if !c.Pending() {
+		t.Fatal("the newer value isn't pending anymore")
+	}
+}
+
+func TestCopyReplacesPending(t *testing.T) {
+	p := new(Memory)
+	c, results := newTestClipboard(p)
+
+	err := c.Copy([]byte("first"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Copy([]byte("second"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case res := <-results:
+		t.Fatalf("replaced timer called OnClear(%v, %v)", res.cleared, res.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := contents(t, p); got != "second" {
+		t.Fatalf("clipboard holds %q, want %q", got, "second")
+	}
+
+	cleared, err := c.Clear()
+	if err != nil || !cleared {
+		t.Fatalf("Clear() = %v, %v, want true, nil", cleared, err)
+	}
+}
+
+func TestUnreadableLeftIntact(t *testing.T) {
+	p := new(unreadable)
+	c, _ := newTestClipboard(p)
+
+	err := c.Copy([]byte("secret"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Pending() {
+		t.Fatal("an unverifiable value is pending without ClearUnverified")
+	}
+	cleared, err := c.Clear()
+	if err != nil || cleared {
+		t.Fatalf("Clear() = %v, %v, want false, nil", cleared, err)
+	}
+	if got, _ := p.Memory.Read(); string(got) != "secret" {
+		t.Fatalf("clipboard holds %q, want it left intact", got)
+	}
+}
+
+func TestUnreadableClearUnverified(t *testing.T) {
+	p := new(unreadable)
+	c, results := newTestClipboard(p)
+	c.ClearUnverified = true
+
+	err := c.Copy([]byte("secret"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := waitClear(t, results)
+	if res.err != nil || !res.cleared {
+		t.Fatalf("OnClear(%v, %v), want OnClear(true, nil)", res.cleared, res.err)
+	}
+	if got, _ := p.Memory.Read(); len(got) != 0 {
+		t.Fatalf("clipboard holds %q after the timeout, want it empty", got)
+	}
+}
+
+// script writes a shell script to the directory and returns its path
+func script(t *testing.T, dir string, name string, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCommandRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clipboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	empty := &command{
+		read:  []string{script(t, dir, "empty", "echo 'Nothing is copied' >&2; exit 1")},
+		empty: []string{"Nothing is copied"},
+	}
+	data, err := empty.Read()
+	if err != nil || len(data) != 0 {
+		t.Errorf("Read() = %q, %v for an empty clipboard", data, err)
+	}
+
+	failing := &command{
+		write: []string{script(t, dir, "write", "cat > /dev/null")},
+		read:  []string{script(t, dir, "fail", "echo 'cannot open display' >&2; exit 1")},
+		clear: []string{script(t, dir, "clear", "exit 0")},
+		empty: []string{"Nothing is copied"},
+	}
+	if _, err = failing.Read(); err == nil || !strings.Contains(err.Error(), "cannot open display") {
+		t.Errorf("Read() = %v, want the tool error", err)
+	}
+
+	// a failure to read the clipboard is reported rather than
+	// taken for the clipboard changed since copying
+	c := NewClipboard(failing)
+	err = c.Copy([]byte("secret"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared, err := c.Clear(); err == nil {
+		t.Errorf("Clear() = %v, nil with the clipboard unreadable", cleared)
+	}
+}
@@ -1,52 +1,235 @@
 package crypter
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"io"
 
-	"github.com/viert/yanpassword/term"
+	"github.com/viert/yanpassword/secmem"
 	"golang.org/x/crypto/pbkdf2"
 )
 
 const (
 	iterCount = 10
+
+	// passphrase-encrypted blobs start with a header of magic, format version,
+	// the key derivation salt and, since version 3, a length-prefixed context.
+	// The whole header is authenticated as GCM additional data.
+	magic            = "YNPW"
+	formatVersionV2  = 2
+	formatVersion    = 3
+	saltSize         = 16
+	headerSizeV2     = len(magic) + 1 + saltSize
+	maxContextLength = 0xffff
+
+	kdfIterCount = 100000
 )
 
-func createHash(passphrase string) ([]byte, error) {
-	bytePasswd := []byte(passphrase)
+var (
+	// ErrLegacyFormat is returned when a blob has no header, meaning
+	// it was encrypted by an older version of yanpassword
+	ErrLegacyFormat = errors.New("data is encrypted in legacy format")
+	// ErrUnsupportedFormat is returned when a blob header has an unknown format version
+	ErrUnsupportedFormat = errors.New("unsupported encryption format, please upgrade yanpassword")
+)
+
+func createHash(passphrase []byte) ([]byte, error) {
 	hasher := md5.New()
-	hasher.Write(bytePasswd)
+	hasher.Write(passphrase)
 	salt := hasher.Sum(nil)
 
-	phash := pbkdf2.Key(bytePasswd, salt, iterCount, 4096, sha1.New)
+	phash := pbkdf2.Key(passphrase, salt, iterCount, 4096, sha1.New)
 	hasher.Reset()
 	hasher.Write(phash)
-	pwdKey := hex.EncodeToString(hasher.Sum(nil))
-	return []byte(pwdKey), nil
+	pwdKey := make([]byte, hex.EncodedLen(md5.Size))
+	hex.Encode(pwdKey, hasher.Sum(nil))
+	return pwdKey, nil
 }
 
-func createHashLegacy(passphrase string) []byte {
+func createHashLegacy(passphrase []byte) []byte {
 	hasher := md5.New()
-	hasher.Write([]byte(passphrase))
+	hasher.Write(passphrase)
 	pwdKey := hex.EncodeToString(hasher.Sum(nil))
 	return []byte(pwdKey)
 }
 
+// IsLegacy checks if the encrypted data has no format header
+func IsLegacy(encrypted []byte) bool {
+	return !bytes.HasPrefix(encrypted, []byte(magic))
+}
+
+// NewSalt generates a new random key derivation salt
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, saltSize)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// parseHeader returns the salt, the context and the full header of encrypted data
+func parseHeader(encrypted []byte) (salt []byte, context []byte, header []byte, err error) {
+	if IsLegacy(encrypted) {
+		return nil, nil, nil, ErrLegacyFormat
+	}
+	if len(encrypted) < headerSizeV2 {
+		return nil, nil, nil, ErrTruncated
+	}
+
+	salt = encrypted[len(magic)+1 : headerSizeV2]
+	switch encrypted[len(magic)] {
+	case formatVersionV2:
+		return salt, nil, encrypted[:headerSizeV2], nil
+	case formatVersion:
+		if len(encrypted) < headerSizeV2+2 {
+			return nil, nil, nil, ErrTruncated
+		}
+		headerSize := headerSizeV2 + 2 + int(binary.BigEndian.Uint16(encrypted[headerSizeV2:]))
+		if len(encrypted) < headerSize {
+			return nil, nil, nil, ErrTruncated
+		}
+		return salt, encrypted[headerSizeV2+2 : headerSize], encrypted[:headerSize], nil
+	default:
+		return nil, nil, nil, ErrUnsupportedFormat
+	}
+}
+
+// Salt extracts the key derivation salt from the encrypted data header
+func Salt(encrypted []byte) ([]byte, error) {
+	salt, _, _, err := parseHeader(encrypted)
+	return salt, err
+}
+
+// DeriveKey derives an AES key from a passphrase and a salt
+func DeriveKey(passphrase []byte, salt []byte) []byte {
+	return pbkdf2.Key(passphrase, salt, kdfIterCount, KeySize, sha256.New)
+}
+
+// Seal encrypts data with a key derived by DeriveKey, prepending the format header.
+// The header including an arbitrary context is authenticated along with the data
+// so that the encrypted data can't be substituted for data of another context.
+func Seal(data []byte, key []byte, salt []byte, context []byte) ([]byte, error) {
+	if len(context) > maxContextLength {
+		return nil, errors.New("encryption context is too long")
+	}
+
+	header := make([]byte, 0, headerSizeV2+2+len(context))
+	header = append(header, magic...)
+	header = append(header, formatVersion)
+	header = append(header, salt...)
+	header = append(header, byte(len(context)>>8), byte(len(context)))
+	header = append(header, context...)
+
+	encrypted, err := seal(data, key, header)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, encrypted...), nil
+}
+
+// Open decrypts data encrypted with Seal returning the authenticated context
+// along with the data. Data sealed without a context has a nil context.
+func Open(encrypted []byte, key []byte) (data []byte, context []byte, err error) {
+	_, context, header, err := parseHeader(encrypted)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err = open(encrypted[len(header):], key, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, context, nil
+}
+
 // Encrypt encrypts data with a passphrase
-func Encrypt(data []byte, passphrase string) ([]byte, error) {
-	// generate password hash
-	pwdKey, err := createHash(passphrase)
+func Encrypt(data []byte, passphrase []byte) ([]byte, error) {
+	salt, err := NewSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	key := DeriveKey(passphrase, salt)
+	defer secmem.Wipe(key)
+	return Seal(data, key, salt, nil)
+}
+
+// Decrypt decrypts data with a passphrase. Data in legacy format is
+// never decrypted, ErrLegacyFormat is returned instead.
+func Decrypt(encrypted []byte, passphrase []byte) ([]byte, error) {
+	salt, err := Salt(encrypted)
 	if err != nil {
 		return nil, err
 	}
 
+	key := DeriveKey(passphrase, salt)
+	defer secmem.Wipe(key)
+	data, _, err := Open(encrypted, key)
+	return data, err
+}
+
+// DecryptLegacy decrypts data encrypted by older versions of yanpassword,
+// reporting if the data was encrypted with a plain MD5 passphrase hash
+func DecryptLegacy(encrypted []byte, passphrase []byte) (data []byte, usedMD5 bool, err error) {
+	if !IsLegacy(encrypted) {
+		return nil, false, errors.New("data is not in legacy format")
+	}
+
+	pwdKey, err := createHash(passphrase)
+	if err != nil {
+		return nil, false, err
+	}
+	defer secmem.Wipe(pwdKey)
+
+	data, err = DecryptWithKey(encrypted, pwdKey)
+	if err == nil {
+		return data, false, nil
+	}
+
+	legacyKey := createHashLegacy(passphrase)
+	defer secmem.Wipe(legacyKey)
+	data, err = DecryptWithKey(encrypted, legacyKey)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// EncryptWithKey encrypts data with a raw AES key
+func EncryptWithKey(data []byte, key []byte) ([]byte, error) {
+	return seal(data, key, nil)
+}
+
+// DecryptWithKey decrypts data with a raw AES key
+func DecryptWithKey(encrypted []byte, key []byte) ([]byte, error) {
+	return open(encrypted, key, nil)
+}
+
+// EncryptWithKeyAD encrypts data with a raw AES key authenticating
+// additional data which must be passed intact to DecryptWithKeyAD
+func EncryptWithKeyAD(data []byte, key []byte, additionalData []byte) ([]byte, error) {
+	return seal(data, key, additionalData)
+}
+
+// DecryptWithKeyAD decrypts data encrypted with EncryptWithKeyAD
+func DecryptWithKeyAD(encrypted []byte, key []byte, additionalData []byte) ([]byte, error) {
+	return open(encrypted, key, additionalData)
+}
+
+func seal(data []byte, key []byte, additionalData []byte) ([]byte, error) {
 	// Creating cipher
-	block, _ := aes.NewCipher(pwdKey)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
 		return nil, err
@@ -58,40 +241,24 @@ func Encrypt(data []byte, passphrase string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return gcm.Seal(nonce, nonce, data, nil), nil
+	return gcm.Seal(nonce, nonce, data, additionalData), nil
 }
 
-// Decrypt decrypts data with a passphrase
-func Decrypt(encrypted []byte, passphrase string) ([]byte, error) {
-
-	// generate password hash
-	pwdKey, err := createHash(passphrase)
+func open(encrypted []byte, key []byte, additionalData []byte) ([]byte, error) {
+	// Creating cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
 	if err != nil {
 		return nil, err
 	}
 
-	legacyTried := false
-	for {
-		// Creating cipher
-		block, _ := aes.NewCipher(pwdKey)
-		gcm, err := cipher.NewGCM(block)
-		if err != nil {
-			return nil, err
-		}
-
-		nonceSize := gcm.NonceSize()
-		nonce, ciphertext := encrypted[:nonceSize], encrypted[nonceSize:]
-		data, err := gcm.Open(nil, nonce, ciphertext, nil)
-		if err != nil {
-			if legacyTried {
-				return nil, err
-			}
-			term.Warnf("Error decrypting data, falling back to legacy MD5 crypter\n")
-			pwdKey = createHashLegacy(passphrase)
-			legacyTried = true
-			continue
-		} else {
-			return data, nil
-		}
+	nonceSize := gcm.NonceSize()
+	if len(encrypted) < nonceSize {
+		return nil, ErrTruncated
 	}
+	nonce, ciphertext := encrypted[:nonceSize], encrypted[nonceSize:]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
 }
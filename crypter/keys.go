@@ -0,0 +1,106 @@
+package crypter
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/viert/yanpassword/secmem"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	// KeySize is the size of symmetric data keys and X25519 keys
+	KeySize = 32
+)
+
+// ErrTruncated is returned when an encrypted blob is too short to be valid
+var ErrTruncated = errors.New("encrypted data is truncated")
+
+// GenerateKey generates a new random symmetric data key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GenerateKeyPair generates a new X25519 key pair
+func GenerateKeyPair() (public []byte, private []byte, err error) {
+	private, err = GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	public, err = curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	return public, private, nil
+}
+
+// PublicKey computes the X25519 public key of a given private key
+func PublicKey(private []byte) ([]byte, error) {
+	return curve25519.X25519(private, curve25519.Basepoint)
+}
+
+// kek derives a key-encryption key from an X25519 shared secret
+// bound to both the ephemeral and the recipient public keys
+func kek(shared, ephemeral, recipient []byte) []byte {
+	hasher := sha256.New()
+	hasher.Write(shared)
+	hasher.Write(ephemeral)
+	hasher.Write(recipient)
+	return hasher.Sum(nil)
+}
+
+// WrapKey encrypts a data key for a recipient's X25519 public key.
+// The result is an ephemeral public key followed by the encrypted data key.
+func WrapKey(key []byte, recipient []byte) ([]byte, error) {
+	ephPublic, ephPrivate, err := GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := curve25519.X25519(ephPrivate, recipient)
+	secmem.Wipe(ephPrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappingKey := kek(shared, ephPublic, recipient)
+	secmem.Wipe(shared)
+	defer secmem.Wipe(wrappingKey)
+
+	wrapped, err := EncryptWithKey(key, wrappingKey)
+	if err != nil {
+		return nil, err
+	}
+	return append(ephPublic, wrapped...), nil
+}
+
+// UnwrapKey decrypts a data key wrapped with WrapKey using the recipient's private key
+func UnwrapKey(wrapped []byte, private []byte) ([]byte, error) {
+	if len(wrapped) < KeySize {
+		return nil, ErrTruncated
+	}
+
+	public, err := PublicKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	ephPublic, encrypted := wrapped[:KeySize], wrapped[KeySize:]
+	shared, err := curve25519.X25519(private, ephPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappingKey := kek(shared, ephPublic, public)
+	secmem.Wipe(shared)
+	defer secmem.Wipe(wrappingKey)
+
+	return DecryptWithKey(encrypted, wrappingKey)
+}
@@ -10,6 +10,7 @@ require (
 	github.com/stamblerre/gocode v1.0.0 // indirect
 	github.com/studio-b12/gowebdav v0.0.0-20190103184047-38f79aeaf1ac
 	golang.org/x/crypto v0.0.0-20201016220609-9e8e0b390897
+	golang.org/x/sys v0.0.0-20200323222414-85ca7c5b95cd
 	golang.org/x/tools v0.0.0-20201017001424-6003fad69a88 // indirect
 )
 
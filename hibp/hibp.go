@@ -0,0 +1,187 @@
+// Package hibp checks passwords against a local copy of the Have I Been Pwned
+// Pwned Passwords list so that no password hash ever leaves the machine
+package hibp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// prefixLen is the length of the hash prefix naming range files
+	prefixLen = 5
+	hashLen   = sha1.Size * 2
+)
+
+// List is a local copy of the Pwned Passwords list
+type List interface {
+	// Count returns how many times the password with the SHA-1 hash
+	// was seen in data breaches, 0 if it never was
+	Count(hash [sha1.Size]byte) (int, error)
+	Close() error
+}
+
+// Open opens the list, the path is either a file of HASH:COUNT lines ordered
+// by hash or a directory of range files named by the first 5 characters of
+// the hashes with SUFFIX:COUNT lines, the way the range API serves them
+func Open(path string) (List, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return &rangeDir{path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &hashFile{f, st.Size()}, nil
+}
+
+// Sum returns the SHA-1 hash of the password
+func Sum(password []byte) [sha1.Size]byte {
+	return sha1.Sum(password)
+}
+
+func upperHex(hash [sha1.Size]byte) []byte {
+	return bytes.ToUpper([]byte(hex.EncodeToString(hash[:])))
+}
+
+// parseLine splits a HASH:COUNT line, lines without a count count once
+func parseLine(line []byte) ([]byte, int, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	colon := bytes.IndexByte(line, ':')
+	if colon < 0 {
+		return bytes.ToUpper(line), 1, nil
+	}
+	count, err := strconv.Atoi(string(bytes.TrimSpace(line[colon+1:])))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid line %q", line)
+	}
+	return bytes.ToUpper(line[:colon]), count, nil
+}
+
+// hashFile is a file of full hashes ordered by hash, it's looked up
+// by binary search so that the whole file is never read
+type hashFile struct {
+	f    *os.File
+	size int64
+}
+
+// lineAfter returns the first line starting at or after the offset
+// along with the offset the line starts at
+func (h *hashFile) lineAfter(offset int64) (int64, []byte, error) {
+	start := offset
+	if offset > 0 {
+		start = offset - 1
+	}
+	r := bufio.NewReader(io.NewSectionReader(h.f, start, h.size-start))
+	if offset > 0 {
+		// skip the rest of the line the offset points into
+		skipped, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return h.size, nil, nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := r.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	return start, line, nil
+}
+
+func (h *hashFile) Count(hash [sha1.Size]byte) (int, error) {
+	target := upperHex(hash)
+	lo, hi := int64(0), h.size
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := h.lineAfter(mid)
+		if err != nil {
+			return 0, err
+		}
+		if start >= hi || len(line) == 0 {
+			hi = mid
+			continue
+		}
+
+		lineHash, count, err := parseLine(line)
+		if err != nil {
+			return 0, err
+		}
+		if len(lineHash) != hashLen {
+			return 0, fmt.Errorf("%s is not a list of SHA-1 hashes", h.f.Name())
+		}
+
+		switch bytes.Compare(lineHash, target) {
+		case 0:
+			return count, nil
+		case -1:
+			lo = start + int64(len(line))
+		default:
+			hi = mid
+		}
+	}
+	return 0, nil
+}
+
+func (h *hashFile) Close() error {
+	return h.f.Close()
+}
+
+// rangeDir is a directory of range files each holding the suffixes
+// of the hashes starting with the file name
+type rangeDir struct {
+	path string
+}
+
+func (d *rangeDir) Count(hash [sha1.Size]byte) (int, error) {
+	hexHash := upperHex(hash)
+	prefix, suffix := string(hexHash[:prefixLen]), hexHash[prefixLen:]
+
+	var f *os.File
+	var err error
+	for _, name := range []string{prefix, prefix + ".txt"} {
+		f, err = os.Open(filepath.Join(d.path, name))
+		if !os.IsNotExist(err) {
+			break
+		}
+	}
+	if os.IsNotExist(err) {
+		return 0, fmt.Errorf("range file %s is missing in %s, the download is incomplete", prefix, d.path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, count, err := parseLine(scanner.Bytes())
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(lineSuffix, suffix) {
+			return count, nil
+		}
+	}
+	return 0, scanner.Err()
+}
+
+func (d *rangeDir) Close() error {
+	return nil
+}
@@ -0,0 +1,177 @@
+package hibp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fixture is a small Pwned Passwords list, the filler passwords spread
+// the hashes so that lookups hit the first and the last lines as well
+func fixture() map[string]int {
+	counts := map[string]int{
+		"password": 3861493,
+		"123456":   37359195,
+		"qwerty":   3946737,
+	}
+	for i := 0; i < 200; i++ {
+		counts[fmt.Sprintf("filler-%d", i)] = i + 1
+	}
+	return counts
+}
+
+func hexSum(password string) string {
+	return strings.ToUpper(fmt.Sprintf("%x", Sum([]byte(password))))
+}
+
+func writeHashFile(t *testing.T, dir string, counts map[string]int) string {
+	t.Helper()
+	lines := make([]string, 0, len(counts))
+	for password, count := range counts {
+		lines = append(lines, fmt.Sprintf("%s:%d\r\n", hexSum(password), count))
+	}
+	sort.Strings(lines)
+
+	filename := filepath.Join(dir, "pwned-passwords-sha1-ordered-by-hash.txt")
+	err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "")), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func writeRangeDir(t *testing.T, dir string, counts map[string]int) string {
+	t.Helper()
+	ranges := make(map[string][]string)
+	for password, count := range counts {
+		hash := hexSum(password)
+		prefix := hash[:prefixLen]
+		ranges[prefix] = append(ranges[prefix], fmt.Sprintf("%s:%d", hash[prefixLen:], count))
+	}
+
+	path := filepath.Join(dir, "ranges")
+	err := os.Mkdir(path, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := 0
+	for prefix, lines := range ranges {
+		// both plain and .txt range file names are looked up
+		name := prefix
+		if i%2 == 1 {
+			name += ".txt"
+		}
+		i++
+		err = ioutil.WriteFile(filepath.Join(path, name), []byte(strings.Join(lines, "\n")+"\n"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func checkList(t *testing.T, list List, counts map[string]int) {
+	t.Helper()
+	for password, want := range counts {
+		count, err := list.Count(Sum([]byte(password)))
+		if err != nil {
+			t.Fatalf("Count(%q): %s", password, err)
+		}
+		if count != want {
+			t.Errorf("Count(%q) = %d, want %d", password, count, want)
+		}
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hibp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	counts := fixture()
+	list, err := Open(writeHashFile(t, dir, counts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+
+	checkList(t, list, counts)
+	for _, password := range []string{"correct horse battery staple", "", "filler-200"} {
+		count, err := list.Count(Sum([]byte(password)))
+		if err != nil || count != 0 {
+			t.Errorf("Count(%q) = %d, %v for a password not in the list", password, count, err)
+		}
+	}
+}
+
+func TestHashFileNotHashes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hibp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "passwords.txt")
+	err = ioutil.WriteFile(filename, []byte("password\nqwerty\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+
+	if _, err = list.Count(Sum([]byte("password"))); err == nil {
+		t.Error("a plain password list accepted as a hash list")
+	}
+}
+
+func TestRangeDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hibp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	counts := fixture()
+	list, err := Open(writeRangeDir(t, dir, counts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+
+	checkList(t, list, counts)
+
+	// a missing range file means the download is incomplete
+	// rather than the password has never been seen
+	missing := "correct horse battery staple"
+	if _, err = list.Count(Sum([]byte(missing))); err == nil {
+		t.Errorf("Count(%q) succeeded with its range file missing", missing)
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	for _, tc := range []struct {
+		line  string
+		hash  string
+		count int
+	}{
+		{"0018a45c4d1def81644b54ab7f969b88d65:21\r\n", "0018A45C4D1DEF81644B54AB7F969B88D65", 21},
+		{"0018A45C4D1DEF81644B54AB7F969B88D65", "0018A45C4D1DEF81644B54AB7F969B88D65", 1},
+	} {
+		hash, count, err := parseLine([]byte(tc.line))
+		if err != nil || string(hash) != tc.hash || count != tc.count {
+			t.Errorf("parseLine(%q) = %s, %d, %v", tc.line, hash, count, err)
+		}
+	}
+	if _, _, err := parseLine([]byte("0018A45C4D1DEF81644B54AB7F969B88D65:many")); err == nil {
+		t.Error("invalid count accepted")
+	}
+}
@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cmdArgs is a command line split into positional arguments and --options
+type cmdArgs struct {
+	positional []string
+	options    map[string]string
+}
+
+// parseArgs splits args into positional arguments and options. Only the
+// options listed are accepted: the ones ending with = take a value as either
+// --opt value or --opt=value, the others are flags.
+func parseArgs(args []string, options ...string) (*cmdArgs, error) {
+	ca := &cmdArgs{positional: make([]string, 0), options: make(map[string]string)}
+
+	takesValue := make(map[string]bool)
+	for _, opt := range options {
+		if strings.HasSuffix(opt, "=") {
+			takesValue[opt[:len(opt)-1]] = true
+		} else {
+			takesValue[opt] = false
+		}
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" {
+			continue
+		}
+		if !strings.HasPrefix(arg, "--") || arg == "--" {
+			ca.positional = append(ca.positional, arg)
+			continue
+		}
+
+		opt := arg[2:]
+		value := ""
+		hasValue := false
+		if eq := strings.Index(opt, "="); eq >= 0 {
+			opt, value, hasValue = opt[:eq], opt[eq+1:], true
+		}
+
+		valueOpt, known := takesValue[opt]
+		switch {
+		case !known:
+			return nil, fmt.Errorf("unknown option --%s", opt)
+		case !valueOpt && hasValue:
+			return nil, fmt.Errorf("option --%s takes no value", opt)
+		case valueOpt && !hasValue:
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("option --%s requires a value", opt)
+			}
+			i++
+			value = args[i]
+		}
+		ca.options[opt] = value
+	}
+	return ca, nil
+}
+
+func (ca *cmdArgs) has(opt string) bool {
+	_, found := ca.options[opt]
+	return found
+}
+
+func (ca *cmdArgs) get(opt string) string {
+	return ca.options[opt]
+}
+
+// parseAge parses durations like 180d or 2w along with
+// anything time.ParseDuration understands
+func parseAge(age string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+		'y': 365 * 24 * time.Hour,
+	}
+
+	if len(age) > 1 {
+		if unit, found := units[age[len(age)-1]]; found {
+			n, err := strconv.Atoi(age[:len(age)-1])
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %s", age)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	return time.ParseDuration(age)
+}
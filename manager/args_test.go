@@ -0,0 +1,32 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	ca, err := parseArgs([]string{"work", "--sort", "updated", "--tree", "--tag=bank"}, "sort=", "tag=", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ca.positional, []string{"work"}) {
+		t.Errorf("positional %v, want [work]", ca.positional)
+	}
+	if ca.get("sort") != "updated" || ca.get("tag") != "bank" || !ca.has("tree") {
+		t.Errorf("unexpected options %v", ca.options)
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--sorted", "updated"},
+		{"--tree=yes"},
+		{"--sort"},
+	} {
+		_, err := parseArgs(args, "sort=", "tree")
+		if err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want an error", args)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/viert/yanpassword/client"
+	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/secmem"
+	"github.com/viert/yanpassword/term"
+)
+
+const (
+	maxAttachmentSize = 5 << 20
+)
+
+// Argument kinds for argsCompleter
+const (
+	argService = iota
+	argAttachment
+	argFile
+	argField
+)
+
+// attachment is a file attached to a service. The file contents is
+// stored in a separate blob next to the passdb file, encrypted with
+// a blob key kept in the service secret.
+type attachment struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	BlobID  string `json:"blob_id"`
+	AddedAt string `json:"added_at"`
+	extra   unknownFields
+}
+
+func attachmentContext(vaultID string, blobID string) []byte {
+	bc := &blobContext{VaultID: vaultID, Role: roleAttachment, BlobID: blobID}
+	return bc.dump()
+}
+
+// sealAttachment encrypts the data with a new blob key
+func sealAttachment(data []byte, vaultID string) (blobID string, key []byte, blob []byte, err error) {
+	blobID, err = newEntryID()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	key, err = crypter.GenerateKey()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	blob, err = crypter.EncryptWithKeyAD(data, key, attachmentContext(vaultID, blobID))
+	if err != nil {
+		secmem.Wipe(key)
+		return "", nil, nil, err
+	}
+	return blobID, key, blob, nil
+}
+
+func openAttachment(blob []byte, key []byte, vaultID string, blobID string) ([]byte, error) {
+	return crypter.DecryptWithKeyAD(blob, key, attachmentContext(vaultID, blobID))
+}
+
+func (si *ServiceInfo) findAttachment(name string) (int, *attachment) {
+	for i, att := range si.Attachments {
+		if att.Name == name {
+			return i, att
+		}
+	}
+	return -1, nil
+}
+
+// loadBlob returns an attachment blob which is either pending upload or stored remotely
+func (m *Manager) loadBlob(blobID string) ([]byte, error) {
+	if blob, found := m.pendingBlobs[blobID]; found {
+		return blob, nil
+	}
+	cli := client.NewPassdbClient(m.webdavAuthData.Username, m.webdavAuthData.Password)
+	return cli.LoadAttachment(blobID)
+}
+
+// referencedBlobs returns the ids of the blobs attached to the entries
+// including the trash ones, copied entries share blobs
+func (m *Manager) referencedBlobs() map[string]bool {
+	blobs := make(map[string]bool)
+	for _, sd := range []serviceData{m.data, m.trash} {
+		for _, si := range sd {
+			for _, att := range si.Attachments {
+				blobs[att.BlobID] = true
+			}
+		}
+	}
+	return blobs
+}
+
+// collectBlobs drops pending blobs nothing refers to anymore and finds the
+// stored ones orphaned by the revision being saved. Orphaned blobs are kept
+// while backup files may refer to them, the ones older than that are returned
+// as expired along with the orphans left.
+func (m *Manager) collectBlobs(revision int64) (orphans map[string]int64, expired []string) {
+	referenced := m.referencedBlobs()
+	for blobID := range m.pendingBlobs {
+		if !referenced[blobID] {
+			delete(m.pendingBlobs, blobID)
+		}
+	}
+
+	orphans = make(map[string]int64)
+	for blobID, orphanedAt := range m.orphanBlobs {
+		if !referenced[blobID] {
+			orphans[blobID] = orphanedAt
+		}
+	}
+	for blobID := range m.storedBlobs {
+		if _, found := orphans[blobID]; !found && !referenced[blobID] {
+			orphans[blobID] = revision
+		}
+	}
+
+	expired = make([]string, 0)
+	for blobID, orphanedAt := range orphans {
+		// the backups hold the revisions preceding the one saved
+		if orphanedAt <= revision-client.MaxBackups {
+			expired = append(expired, blobID)
+			delete(orphans, blobID)
+		}
+	}
+	sort.Strings(expired)
+	return orphans, expired
+}
+
+// deleteBlobs removes expired orphan blobs, a blob failed to be removed
+// is left behind as there's nothing referring to it anymore
+func deleteBlobs(cli *client.PassdbClient, expired []string) {
+	for _, blobID := range expired {
+		err := cli.DeleteAttachment(blobID)
+		if err != nil {
+			term.Warnf("Error removing unused attachment blob %s: %s\n", blobID, err)
+		}
+	}
+}
+
+// rekeyAttachments re-encrypts every attachment with a new blob key
+// so that former vault members knowing the previous keys can't read them.
+// The previous blobs are orphaned and removed once backups expire.
+func (m *Manager) rekeyAttachments() error {
+	type rekeyedBlob struct {
+		id  string
+		key []byte
+	}
+
+	// blobs shared by copied entries are re-encrypted once,
+	// nothing is changed until every blob is re-encrypted
+	rekeyed := make(map[string]*rekeyedBlob)
+	blobs := make(map[string][]byte)
+	for _, sd := range []serviceData{m.data, m.trash} {
+		for _, si := range sd {
+			if len(si.Attachments) == 0 {
+				continue
+			}
+			secret, err := m.revealSecret(si)
+			if err != nil {
+				return fmt.Errorf("error decrypting service %s: %s", si.Name, err)
+			}
+			for _, att := range si.Attachments {
+				if _, found := rekeyed[att.BlobID]; found {
+					continue
+				}
+				key, found := secret.AttachmentKeys[att.BlobID]
+				if !found {
+					return fmt.Errorf("service %s has no key for attachment %s", si.Name, att.Name)
+				}
+				blob, err := m.loadBlob(att.BlobID)
+				if err != nil {
+					return fmt.Errorf("error loading attachment %s of %s: %s", att.Name, si.Name, err)
+				}
+				data, err := openAttachment(blob, key, m.vaultID, att.BlobID)
+				if err != nil {
+					return fmt.Errorf("error decrypting attachment %s of %s: %s", att.Name, si.Name, err)
+				}
+				blobID, newKey, newBlob, err := sealAttachment(data, m.vaultID)
+				secmem.Wipe(data)
+				if err != nil {
+					return fmt.Errorf("error encrypting attachment %s of %s: %s", att.Name, si.Name, err)
+				}
+				rekeyed[att.BlobID] = &rekeyedBlob{blobID, newKey}
+				blobs[blobID] = newBlob
+			}
+		}
+	}
+	if len(rekeyed) == 0 {
+		return nil
+	}
+
+	for _, sd := range []serviceData{m.data, m.trash} {
+		for _, si := range sd {
+			if len(si.Attachments) == 0 {
+				continue
+			}
+			secret, err := m.revealSecret(si)
+			if err != nil {
+				return fmt.Errorf("error decrypting service %s: %s", si.Name, err)
+			}
+			for _, att := range si.Attachments {
+				rb := rekeyed[att.BlobID]
+				secmem.Wipe(secret.AttachmentKeys[att.BlobID])
+				delete(secret.AttachmentKeys, att.BlobID)
+				secret.AttachmentKeys[rb.id] = append([]byte{}, rb.key...)
+			}
+			err = m.setSecret(si, secret)
+			if err != nil {
+				return fmt.Errorf("error encrypting service %s: %s", si.Name, err)
+			}
+			for _, att := range si.Attachments {
+				att.BlobID = rekeyed[att.BlobID].id
+			}
+		}
+	}
+
+	if m.pendingBlobs == nil {
+		m.pendingBlobs = make(map[string][]byte)
+	}
+	for blobID, blob := range blobs {
+		m.pendingBlobs[blobID] = blob
+	}
+	for _, rb := range rekeyed {
+		secmem.Wipe(rb.key)
+	}
+	return nil
+}
+
+func (m *Manager) uploadPendingBlobs(cli *client.PassdbClient) error {
+	for blobID, blob := range m.pendingBlobs {
+		err := cli.SaveAttachment(blobID, blob)
+		if err != nil {
+			return err
+		}
+		delete(m.pendingBlobs, blobID)
+	}
+	return nil
+}
+
+func (m *Manager) doAttach(name string, argsLine string, args ...string) {
+	if len(args) < 2 {
+		term.Errorf("Use %s <service> <filename> to attach a file to the service\n", name)
+		return
+	}
+
+	serviceName := args[0]
+	si, found := m.lookup(serviceName)
+	if !found {
+		term.Errorf("Service %s not found\n", serviceName)
+		return
+	}
+
+	filename := args[1]
+	st, err := os.Stat(filename)
+	if err != nil {
+		term.Errorf("Error reading file %s: %s\n", filename, err)
+		return
+	}
+	if st.IsDir() {
+		term.Errorf("%s is a directory\n", filename)
+		return
+	}
+	if st.Size() > maxAttachmentSize {
+		term.Errorf("File %s is too large, attachments are limited to %d bytes\n", filename, maxAttachmentSize)
+		return
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		term.Errorf("Error reading file %s: %s\n", filename, err)
+		return
+	}
+	defer secmem.Wipe(data)
+
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+		return
+	}
+
+	blobID, key, blob, err := sealAttachment(data, m.vaultID)
+	if err != nil {
+		term.Errorf("Error encrypting file %s: %s\n", filename, err)
+		return
+	}
+
+	att := &attachment{
+		Name:    filepath.Base(filename),
+		Size:    int64(len(data)),
+		BlobID:  blobID,
+		AddedAt: timestamp(),
+	}
+
+	if secret.AttachmentKeys == nil {
+		secret.AttachmentKeys = make(map[string][]byte)
+	}
+	// a file with the same name is replaced, the previous blob is removed
+	// on save once no backup file refers to it
+	idx, prev := si.findAttachment(att.Name)
+	if prev != nil {
+		delete(secret.AttachmentKeys, prev.BlobID)
+	}
+	secret.AttachmentKeys[blobID] = key
+
+	err = m.setSecret(si, secret)
+	if err != nil {
+		term.Errorf("Error encrypting service %s: %s\n", serviceName, err)
+		return
+	}
+
+	if prev != nil {
+		si.Attachments[idx] = att
+	} else {
+		si.Attachments = append(si.Attachments, att)
+	}
+	if m.pendingBlobs == nil {
+		m.pendingBlobs = make(map[string][]byte)
+	}
+	m.pendingBlobs[blobID] = blob
+	si.touch()
+
+	term.Successf("File %s attached to %s. Don't forget to **save** the result.\n", att.Name, serviceName)
+}
+
+func (m *Manager) doAttachments(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		term.Errorf("%s command requires a service name\n", name)
+		return
+	}
+
+	serviceName := args[0]
+	si, found := m.lookup(serviceName)
+	if !found {
+		term.Errorf("Service %s not found\n", serviceName)
+		return
+	}
+
+	if len(si.Attachments) == 0 {
+		term.Warnf("Service %s has no attachments\n", serviceName)
+		return
+	}
+
+	width := 0
+	for _, att := range si.Attachments {
+		if len(att.Name) > width {
+			width = len(att.Name)
+		}
+	}
+	for _, att := range si.Attachments {
+		fmt.Printf("%-*s  %10d  %s\n", width, att.Name, att.Size, displayTimestamp(att.AddedAt))
+	}
+}
+
+func (m *Manager) doExtract(name string, argsLine string, args ...string) {
+	if len(args) < 3 {
+		term.Errorf("Use %s <service> <attachment> <destination> to save an attachment to a file\n", name)
+		return
+	}
+
+	serviceName := args[0]
+	si, found := m.lookup(serviceName)
+	if !found {
+		term.Errorf("Service %s not found\n", serviceName)
+		return
+	}
+
+	_, att := si.findAttachment(args[1])
+	if att == nil {
+		term.Errorf("Service %s has no attachment %s\n", serviceName, args[1])
+		return
+	}
+
+	dest := args[2]
+	if st, err := os.Stat(dest); err == nil {
+		if !st.IsDir() {
+			term.Errorf("File %s already exists\n", dest)
+			return
+		}
+		dest = filepath.Join(dest, att.Name)
+		if _, err := os.Stat(dest); err == nil {
+			term.Errorf("File %s already exists\n", dest)
+			return
+		}
+	}
+
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+		return
+	}
+	key, found := secret.AttachmentKeys[att.BlobID]
+	if !found {
+		term.Errorf("Service %s has no key for attachment %s\n", serviceName, att.Name)
+		return
+	}
+
+	blob, err := m.loadBlob(att.BlobID)
+	if err != nil {
+		term.Errorf("Error loading attachment %s: %s\n", att.Name, err)
+		return
+	}
+
+	data, err := openAttachment(blob, key, m.vaultID, att.BlobID)
+	if err != nil {
+		term.Errorf("Error decrypting attachment %s: %s\n", att.Name, err)
+		return
+	}
+	defer secmem.Wipe(data)
+
+	err = ioutil.WriteFile(dest, data, os.FileMode(0600))
+	if err != nil {
+		term.Errorf("Error writing file %s: %s\n", dest, err)
+		return
+	}
+	term.Successf("Attachment %s saved to %s\n", att.Name, dest)
+}
+
+func (m *Manager) doDetach(name string, argsLine string, args ...string) {
+	if len(args) < 2 {
+		term.Errorf("Use %s <service> <attachment> to remove an attachment\n", name)
+		return
+	}
+
+	serviceName := args[0]
+	si, found := m.lookup(serviceName)
+	if !found {
+		term.Errorf("Service %s not found\n", serviceName)
+		return
+	}
+
+	idx, att := si.findAttachment(args[1])
+	if att == nil {
+		term.Errorf("Service %s has no attachment %s\n", serviceName, args[1])
+		return
+	}
+
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+		return
+	}
+	delete(secret.AttachmentKeys, att.BlobID)
+
+	err = m.setSecret(si, secret)
+	if err != nil {
+		term.Errorf("Error encrypting service %s: %s\n", serviceName, err)
+		return
+	}
+
+	si.Attachments = append(si.Attachments[:idx], si.Attachments[idx+1:]...)
+	if !m.referencedBlobs()[att.BlobID] {
+		// copies of the entry may share the blob
+		delete(m.pendingBlobs, att.BlobID)
+	}
+	si.touch()
+	term.Successf("Attachment %s removed. Don't forget to **save** the result.\n", att.Name)
+}
+
+// argsCompleter completes positional arguments by their kinds
+func (m *Manager) argsCompleter(kinds ...int) completeFunc {
+	nc := m.nameCompleter()
+	return func(line []rune) (newLine [][]rune, length int) {
+		tokens := exprWhiteSpace.Split(string(line), -1)
+		n := len(tokens) - 1
+		if n >= len(kinds) {
+			return [][]rune{}, 0
+		}
+		prefix := tokens[n]
+
+		switch kinds[n] {
+		case argService:
+			return nc(line)
+		case argFile:
+			return completeFiles([]rune(prefix))
+		case argAttachment:
+			sr := make([]string, 0)
+			if si, found := m.lookup(tokens[0]); found {
+				for _, att := range si.Attachments {
+					if strings.HasPrefix(att.Name, prefix) {
+						sr = append(sr, att.Name[len(prefix):])
+					}
+				}
+			}
+			sort.Strings(sr)
+			return toRunes(sr), len([]rune(prefix))
+		case argField:
+			sr := make([]string, 0)
+			if si, found := m.lookup(tokens[0]); found {
+				for _, field := range si.copyableFields() {
+					if strings.HasPrefix(field, prefix) {
+						sr = append(sr, field[len(prefix):])
+					}
+				}
+			}
+			return toRunes(sr), len([]rune(prefix))
+		}
+		return [][]rune{}, 0
+	}
+}
@@ -0,0 +1,154 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/viert/yanpassword/client"
+)
+
+func attachTestFile(t *testing.T, m *Manager, service string, contents string) *attachment {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "yanpassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "key.txt")
+	err = ioutil.WriteFile(filename, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.doAttach("attach", "", service, filename)
+	si, _ := m.lookup(service)
+	_, att := si.findAttachment("key.txt")
+	if att == nil {
+		t.Fatalf("file not attached to %s", service)
+	}
+	return att
+}
+
+func extractTestFile(t *testing.T, m *Manager, service string) string {
+	t.Helper()
+	si, _ := m.lookup(service)
+	_, att := si.findAttachment("key.txt")
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := m.loadBlob(att.BlobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := openAttachment(blob, secret.AttachmentKeys[att.BlobID], m.vaultID, att.BlobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDetachKeepsSharedPendingBlob(t *testing.T) {
+	m := newTestManager(t)
+	addTestService(t, m, "server", "secret")
+	att := attachTestFile(t, m, "server", "key data")
+
+	m.doCopy("cp", "", "server", "server2")
+	m.doDetach("detach", "", "server", "key.txt")
+	if _, found := m.pendingBlobs[att.BlobID]; !found {
+		t.Fatal("blob shared with the copy dropped")
+	}
+	if got := extractTestFile(t, m, "server2"); got != "key data" {
+		t.Errorf("copy attachment is %q", got)
+	}
+
+	m.doDetach("detach", "", "server2", "key.txt")
+	if _, found := m.pendingBlobs[att.BlobID]; found {
+		t.Fatal("unreferenced pending blob kept")
+	}
+}
+
+func TestCollectBlobs(t *testing.T) {
+	m := newTestManager(t)
+	addTestService(t, m, "server", "secret")
+	att := attachTestFile(t, m, "server", "key data")
+	stored := att.BlobID
+	// the blob is uploaded by the save at revision 10
+	delete(m.pendingBlobs, stored)
+	m.storedBlobs = m.referencedBlobs()
+
+	// replacing the file orphans the stored blob
+	replaced := attachTestFile(t, m, "server", "new key data")
+	orphans, expired := m.collectBlobs(11)
+	if orphans[stored] != 11 || len(expired) != 0 {
+		t.Fatalf("orphans %v, expired %v, want %s orphaned at 11", orphans, expired, stored)
+	}
+	if _, found := m.pendingBlobs[replaced.BlobID]; !found {
+		t.Fatal("referenced pending blob dropped")
+	}
+	m.orphanBlobs = orphans
+	m.storedBlobs = m.referencedBlobs()
+
+	// backups of the revisions 11-15 still refer to the blob
+	orphans, expired = m.collectBlobs(11 + client.MaxBackups - 1)
+	if len(expired) != 0 || orphans[stored] != 11 {
+		t.Fatalf("orphans %v, expired %v, want %s kept", orphans, expired, stored)
+	}
+	orphans, expired = m.collectBlobs(11 + client.MaxBackups)
+	if len(expired) != 1 || expired[0] != stored || len(orphans) != 0 {
+		t.Fatalf("orphans %v, expired %v, want %s expired", orphans, expired, stored)
+	}
+}
+
+func TestCollectBlobsKeepsTrash(t *testing.T) {
+	m := newTestManager(t)
+	si := addTestService(t, m, "server", "secret")
+	att := attachTestFile(t, m, "server", "key data")
+	delete(m.pendingBlobs, att.BlobID)
+	m.storedBlobs = m.referencedBlobs()
+
+	m.remove(si)
+	si.DeletedAt = timestamp()
+	m.trash[si.ID] = si
+	if orphans, _ := m.collectBlobs(2); len(orphans) != 0 {
+		t.Fatalf("blob of a trash entry orphaned: %v", orphans)
+	}
+
+	m.doEmptyTrash("empty-trash", "")
+	if orphans, _ := m.collectBlobs(2); orphans[att.BlobID] != 2 {
+		t.Fatalf("blob of a purged entry not orphaned: %v", orphans)
+	}
+}
+
+func TestRekeyAttachments(t *testing.T) {
+	m := newTestManager(t)
+	addTestService(t, m, "server", "secret")
+	att := attachTestFile(t, m, "server", "key data")
+	m.doCopy("cp", "", "server", "server2")
+	prevID := att.BlobID
+
+	err := m.rekeyAttachments()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	si, _ := m.lookup("server")
+	copied, _ := m.lookup("server2")
+	if si.Attachments[0].BlobID == prevID {
+		t.Fatal("attachment not re-encrypted")
+	}
+	if si.Attachments[0].BlobID != copied.Attachments[0].BlobID {
+		t.Error("shared blob re-encrypted twice")
+	}
+	secret, _ := m.revealSecret(si)
+	if _, found := secret.AttachmentKeys[prevID]; found || len(secret.AttachmentKeys) != 1 {
+		t.Errorf("attachment keys not replaced: %d keys", len(secret.AttachmentKeys))
+	}
+	for _, name := range []string{"server", "server2"} {
+		if got := extractTestFile(t, m, name); got != "key data" {
+			t.Errorf("%s attachment is %q", name, got)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/viert/yanpassword/hibp"
+	"github.com/viert/yanpassword/strength"
+	"github.com/viert/yanpassword/term"
+)
+
+// Audit issue kinds
+const (
+	issueBreached   = "breached"
+	issueWeak       = "weak"
+	issueReused     = "reused"
+	issueHTTP       = "http"
+	issueStale      = "stale"
+	issueNoUsername = "no-username"
+)
+
+const (
+	defaultStaleDays = 365
+	// auditEntryPoints is the score of an entry with no issues,
+	// every issue takes away its weight
+	auditEntryPoints = 10
+)
+
+// auditIssueKinds are the issue kinds in the report order
+var auditIssueKinds = []string{issueBreached, issueWeak, issueReused, issueHTTP, issueStale, issueNoUsername}
+
+var auditIssueWeights = map[string]int{
+	issueBreached:   6,
+	issueWeak:       4,
+	issueReused:     3,
+	issueHTTP:       1,
+	issueStale:      1,
+	issueNoUsername: 1,
+}
+
+var auditIssueTitles = map[string]string{
+	issueBreached:   "Breached passwords",
+	issueWeak:       "Weak passwords",
+	issueReused:     "Reused passwords",
+	issueHTTP:       "Plain HTTP URLs",
+	issueStale:      "Stale services",
+	issueNoUsername: "Missing usernames",
+}
+
+type auditIssue struct {
+	Service string `json:"service"`
+	Kind    string `json:"kind"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+type auditReport struct {
+	AuditedAt string        `json:"audited_at"`
+	Services  int           `json:"services"`
+	Score     int           `json:"score"`
+	Issues    []*auditIssue `json:"issues"`
+}
+
+func (r *auditReport) add(si *ServiceInfo, kind string, detail string) {
+	r.Issues = append(r.Issues, &auditIssue{Service: si.Name, Kind: kind, Detail: detail})
+}
+
+// hasUsername returns true if the entry is supposed to have a username
+func (si *ServiceInfo) hasUsername() bool {
+	if tmpl := si.template(); tmpl != nil {
+		return tmpl.has(templateUsername)
+	}
+	return !si.isNote()
+}
+
+// audit scans the services for weak, reused and stale passwords,
+// plain http URLs and missing usernames. Passwords are checked against
+// the Pwned Passwords list if one is given.
+func (m *Manager) audit(staleDays int, breachList hibp.List) (*auditReport, error) {
+	now := time.Now()
+	report := &auditReport{AuditedAt: now.UTC().Format(time.RFC3339), Issues: make([]*auditIssue, 0)}
+	minScore := strength.Fair
+	if m.config.MinPasswordScore > minScore {
+		minScore = m.config.MinPasswordScore
+	}
+
+	// services sharing a password are grouped by the password hash
+	reused := make(map[[sha256.Size]byte][]*ServiceInfo)
+	names := m.serviceNames()
+	for _, name := range names {
+		si, _ := m.lookup(name)
+		report.Services++
+
+		secret, err := m.revealSecret(si)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting service %s: %s", si.Name, err)
+		}
+
+		if secret.Password != "" {
+			res := strength.Estimate([]byte(secret.Password), si.strengthInputs()...)
+			if res.Score < minScore {
+				detail := fmt.Sprintf("%s (%d/%d)", res.Label(), res.Score, strength.Strong)
+				if len(res.Warnings) > 0 {
+					detail += ": " + res.Warnings[0]
+				}
+				report.add(si, issueWeak, detail)
+			}
+			h := sha256.Sum256([]byte(secret.Password))
+			reused[h] = append(reused[h], si)
+		}
+
+		if strings.HasPrefix(strings.ToLower(si.URL), "http://") {
+			report.add(si, issueHTTP, si.URL)
+		}
+
+		updated := si.updatedTime()
+		if updated.IsZero() {
+			report.add(si, issueStale, "never updated")
+		} else if days := int(now.Sub(updated).Hours() / 24); days >= staleDays {
+			report.add(si, issueStale, fmt.Sprintf("not updated for %d days", days))
+		}
+
+		if si.hasUsername() && si.Username == "" {
+			report.add(si, issueNoUsername, "")
+		}
+	}
+
+	if breachList != nil {
+		breached, err := m.breachedEntries(breachList)
+		if err != nil {
+			return nil, err
+		}
+		for _, be := range breached {
+			report.add(be.si, issueBreached, fmt.Sprintf("seen %d times in data breaches", be.count))
+		}
+	}
+
+	for _, group := range reused {
+		if len(group) < 2 {
+			continue
+		}
+		for _, si := range group {
+			others := make([]string, 0, len(group)-1)
+			for _, other := range group {
+				if other != si {
+					others = append(others, other.Name)
+				}
+			}
+			sort.Strings(others)
+			report.add(si, issueReused, "same as "+strings.Join(others, ", "))
+		}
+	}
+
+	order := make(map[string]int)
+	for i, kind := range auditIssueKinds {
+		order[kind] = i
+	}
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		a, b := report.Issues[i], report.Issues[j]
+		if a.Kind != b.Kind {
+			return order[a.Kind] < order[b.Kind]
+		}
+		return a.Service < b.Service
+	})
+
+	report.score()
+	return report, nil
+}
+
+// score sums up the points of every service, 100 means no issues found
+func (r *auditReport) score() {
+	if r.Services == 0 {
+		r.Score = 100
+		return
+	}
+
+	penalties := make(map[string]int)
+	for _, issue := range r.Issues {
+		penalties[issue.Service] += auditIssueWeights[issue.Kind]
+	}
+	lost := 0
+	for _, penalty := range penalties {
+		if penalty > auditEntryPoints {
+			penalty = auditEntryPoints
+		}
+		lost += penalty
+	}
+	total := r.Services * auditEntryPoints
+	r.Score = int(math.Round(float64(total-lost) * 100 / float64(total)))
+}
+
+func (r *auditReport) print() {
+	byKind := make(map[string][]*auditIssue)
+	width := 0
+	for _, issue := range r.Issues {
+		byKind[issue.Kind] = append(byKind[issue.Kind], issue)
+		if len(issue.Service) > width {
+			width = len(issue.Service)
+		}
+	}
+
+	for _, kind := range auditIssueKinds {
+		issues := byKind[kind]
+		if len(issues) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d)\n", term.Blue(auditIssueTitles[kind]), len(issues))
+		for _, issue := range issues {
+			fmt.Printf("  %-*s  %s\n", width, issue.Service, issue.Detail)
+		}
+		fmt.Println()
+	}
+
+	summary := fmt.Sprintf("Audited %d services, security score %d/100", r.Services, r.Score)
+	if len(r.Issues) == 0 {
+		term.Successf("%s, no issues found\n", summary)
+	} else {
+		term.Warnf("%s, %d issues found\n", summary, len(r.Issues))
+	}
+}
+
+func (m *Manager) doAudit(name string, argsLine string, args ...string) {
+	ca, err := parseArgs(args, "days=", "json")
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+
+	staleDays := defaultStaleDays
+	if ca.has("days") {
+		staleDays, err = strconv.Atoi(ca.get("days"))
+		if err != nil || staleDays < 1 {
+			term.Errorf("Invalid number of days %s\n", ca.get("days"))
+			return
+		}
+	}
+
+	var breachList hibp.List
+	if m.config.HIBPPath != "" {
+		breachList, err = m.openBreachList("")
+		if err != nil {
+			term.Errorf("%s\n", err)
+			return
+		}
+		defer breachList.Close()
+	}
+
+	report, err := m.audit(staleDays, breachList)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+
+	if ca.has("json") {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			term.Errorf("Error encoding the report: %s\n", err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+	report.print()
+}
@@ -2,83 +2,103 @@ package manager
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path"
 	"strings"
 
 	"github.com/viert/yanpassword/client"
 	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/secmem"
 	"github.com/viert/yanpassword/term"
 )
 
-const (
-	authFilename = ".yanpasswd_auth"
-)
-
 // AuthData represents Yandex user auth data to authenticate with in Webdav service
 type AuthData struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	PublicKey  []byte `json:"public_key,omitempty"`
+	PrivateKey []byte `json:"private_key,omitempty"`
 }
 
 func (ad *AuthData) dump() ([]byte, error) {
 	return json.Marshal(ad)
 }
 
-func getAuthDataFilename() string {
-	return path.Join(os.Getenv("HOME"), authFilename)
-}
-
-func authdataExists() bool {
-	_, err := os.Stat(getAuthDataFilename())
-	if err == nil {
-		return true
+func (m *Manager) acquireAuthData() error {
+	exists, err := m.authStore.Exists()
+	if err != nil {
+		term.Errorf("Error checking auth data in %s: %s\n", m.authStore, err)
+		return err
 	}
-	return !os.IsNotExist(err)
-}
 
-func (m *Manager) acquireAuthData() error {
-	if authdataExists() {
+	if exists {
 		for {
 			pwd, err := m.getMasterPassword()
 			if err != nil {
 				return err
 			}
-			m.masterPassword = pwd
+			err = m.setMasterPassword(pwd)
+			if err != nil {
+				return err
+			}
 
 			fmt.Println("Checking Yandex webdav auth...")
 			authData, err := m.loadWebdavAuth()
+			if err == errLegacyRefused || err == errAuthRefused {
+				return err
+			}
 			if err != nil {
 				continue
 			}
 
 			if m.checkWebdavAuth(authData) {
 				m.webdavAuthData = authData
-				return nil
+				err = m.ensureKeyPair()
+				if err == nil && m.migrateAuth {
+					err = m.requireWritableAuthStore("Auth data has to be migrated to the current format")
+					if err == nil {
+						err = m.saveWevdavAuth(m.webdavAuthData)
+					}
+				}
+				return err
 			}
 
-			fmt.Println(`
-Looks like your current auth data file contains invalid authentication data.
-To prevent data loss I'm going to give up now. If you want to create a new 
-auth data file, please remove ~/.yanpasswd_auth manually and restart yanpassword.` + "\n")
+			fmt.Printf(`
+Looks like your current auth data contains invalid authentication data.
+To prevent data loss I'm going to give up now. If you want to create new
+auth data, please remove %s manually and restart yanpassword.`+"\n\n", m.authStore)
 			return fmt.Errorf("Valid auth data file contains invalid credentials")
 
 		}
 	} else {
-		fmt.Println(`
+		// read-only stores can't keep new auth data, so don't walk
+		// the user through the setup just to fail saving it
+		err = m.requireWritableAuthStore("No auth data found")
+		if err != nil {
+			return err
+		}
+		fmt.Print(`
 Seems like you're running Yanpassword for the first time.
-Let's set your master password. If you already have yanpassword data on Yandex.Disk, feel free
-to use the same password as before or create a new one - doesn't matter. If anything goes wrong
-with decrypting your existing data I'll prompt for a proper password.` + "\n")
+Let's set your master password. If you already have a yanpassword vault on Yandex.Disk, use the
+same master password as before: a new vault key pair is created with the auth data, and the vault
+is opened with your recovery key which is encrypted with the master password. If the password has
+changed since, I'll prompt for the previous one. Use the chpass command to change it later.` + "\n\n")
 		// Set new MP
 		pwd, err := m.setNewMasterPassword()
 		if err != nil {
 			return err
 		}
-		m.masterPassword = pwd
+		err = m.setMasterPassword(pwd)
+		if err != nil {
+			return err
+		}
+		err = m.deriveMasterKey(nil)
+		if err != nil {
+			return err
+		}
 		return m.createNewAuthData()
 	}
 }
@@ -86,25 +106,94 @@ with decrypting your existing data I'll prompt for a proper password.` + "\n")
 func (m *Manager) createNewAuthData() error {
 	var authData AuthData
 	var err error
-	fmt.Println(`
+	fmt.Print(`
 Let's deal with your Yandex.Disk account. 
 You can use your primary Yandex account password, however, it's recommended 
 to turn on application passwords at https://passport.yandex.ru and create
-a special password for Yanpassword only (use Yandex.Disk/Webdav type of password).` + "\n")
+a special password for Yanpassword only (use Yandex.Disk/Webdav type of password).` + "\n\n")
 	for {
 		authData, err = m.inputWebdavAuth()
 		if err != nil {
 			return err
 		}
 		if m.checkWebdavAuth(authData) {
-			m.webdavAuthData = authData
 			break
 		}
 	}
-	return m.saveWevdavAuth(authData)
+
+	m.webdavAuthData = authData
+	err = m.generateKeyPair()
+	if err != nil {
+		return err
+	}
+	return m.saveWevdavAuth(m.webdavAuthData)
+}
+
+// ensureKeyPair moves the vault private key to locked memory, generating
+// a new key pair for auth data files created by older versions of yanpassword
+func (m *Manager) ensureKeyPair() error {
+	var err error
+	ad := &m.webdavAuthData
+	if len(ad.PrivateKey) == crypter.KeySize {
+		m.privateKey, err = secmem.NewFrom(ad.PrivateKey)
+		ad.PrivateKey = nil
+		return err
+	}
+
+	err = m.requireWritableAuthStore("Auth data has no vault key pair yet and has to be updated")
+	if err != nil {
+		return err
+	}
+	fmt.Println("Generating vault key pair...")
+	err = m.generateKeyPair()
+	if err != nil {
+		return err
+	}
+	return m.saveWevdavAuth(*ad)
+}
+
+func (m *Manager) generateKeyPair() error {
+	public, private, err := crypter.GenerateKeyPair()
+	if err != nil {
+		term.Errorf("Error generating vault key pair: %s\n", err)
+		return err
+	}
+	m.webdavAuthData.PublicKey = public
+	m.privateKey, err = secmem.NewFrom(private)
+	return err
+}
+
+// setMasterPassword keeps the master password in locked memory
+// only until the passdb is opened
+func (m *Manager) setMasterPassword(pwd []byte) error {
+	var err error
+	m.masterPassword.Destroy()
+	m.masterPassword, err = secmem.NewFrom(pwd)
+	return err
+}
+
+// deriveMasterKey derives the master key once so that the auth data file
+// can be re-saved without the master password. A new salt is generated if
+// salt is nil.
+func (m *Manager) deriveMasterKey(salt []byte) error {
+	var err error
+	if salt == nil {
+		salt, err = crypter.NewSalt()
+		if err != nil {
+			return err
+		}
+	}
+
+	m.masterKey.Destroy()
+	m.masterKey, err = secmem.NewFrom(crypter.DeriveKey(m.masterPassword.Bytes(), salt))
+	if err != nil {
+		return err
+	}
+	m.masterSalt = append([]byte{}, salt...)
+	return nil
 }
 
-func (m *Manager) setNewMasterPassword() (string, error) {
+func (m *Manager) setNewMasterPassword() ([]byte, error) {
 	var pwd []byte
 	var pwdConfirm []byte
 	var err error
@@ -112,36 +201,96 @@ func (m *Manager) setNewMasterPassword() (string, error) {
 	for {
 		pwd, err = m.rl.ReadPassword("Set Master Password: ")
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		if string(pwd) == "" {
+		if len(pwd) == 0 {
 			term.Errorf("Master password can't be empty\n\n")
 			continue
 		}
+		if !checkStrength(pwd, m.config.MinMasterPasswordScore) {
+			secmem.Wipe(pwd)
+			fmt.Println()
+			continue
+		}
 
 		pwdConfirm, err = m.rl.ReadPassword("Confirm Master Password: ")
 		if err != nil {
-			return "", err
+			secmem.Wipe(pwd)
+			return nil, err
 		}
 
-		if string(pwd) == string(pwdConfirm) {
+		match := bytes.Equal(pwd, pwdConfirm)
+		secmem.Wipe(pwdConfirm)
+		if match {
 			break
 		}
+		secmem.Wipe(pwd)
 		term.Errorf("Passwords don't match\n\n")
 	}
-	return string(pwd), nil
+	return pwd, nil
 }
 
-func (m *Manager) getMasterPassword() (string, error) {
+// doChpass changes the master password re-encrypting the auth data in place,
+// so the vault key pair is kept
+func (m *Manager) doChpass(name string, argsLine string, args ...string) {
+	if m.requireWritableAuthStore("Auth data has to be re-encrypted with the new master password") != nil {
+		return
+	}
+
+	current, err := m.rl.ReadPassword("Current Master Password: ")
+	if err != nil {
+		return
+	}
+	key := crypter.DeriveKey(current, m.masterSalt)
+	secmem.Wipe(current)
+	match := subtle.ConstantTimeCompare(key, m.masterKey.Bytes()) == 1
+	secmem.Wipe(key)
+	if !match {
+		term.Errorf("Wrong master password\n")
+		return
+	}
+
+	pwd, err := m.setNewMasterPassword()
+	if err != nil {
+		return
+	}
+
+	prevKey, prevSalt := m.masterKey, m.masterSalt
+	m.masterKey = nil
+	err = m.setMasterPassword(pwd)
+	if err == nil {
+		err = m.deriveMasterKey(nil)
+	}
+	m.masterPassword.Destroy()
+	m.masterPassword = nil
+	if err == nil {
+		err = m.saveWevdavAuth(m.webdavAuthData)
+	}
+	if err != nil {
+		m.masterKey.Destroy()
+		m.masterKey, m.masterSalt = prevKey, prevSalt
+		term.Errorf("Master password is not changed\n")
+		return
+	}
+	prevKey.Destroy()
+
+	if m.config.DisablePasswordRecovery {
+		term.Successf("Master password changed\n")
+	} else {
+		term.Successf("Master password changed. Don't forget to **save** the result, your recovery key is re-encrypted with the new password on save.\n")
+	}
+}
+
+func (m *Manager) getMasterPassword() ([]byte, error) {
 	for {
 		pwd, err := m.rl.ReadPassword("Enter Master Password: ")
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
-		if string(pwd) != "" {
-			return string(pwd), nil
+		if len(pwd) > 0 {
+			return pwd, nil
 		}
 	}
 }
@@ -187,50 +336,157 @@ func (m *Manager) checkWebdavAuth(authData AuthData) bool {
 }
 
 func (m *Manager) saveWevdavAuth(authData AuthData) error {
+	authData.PrivateKey = m.privateKey.Bytes()
 	authJSON, err := authData.dump()
 	if err != nil {
 		term.Errorf("Error marshalling auth data, this must be a bug: %s\n", err)
 		return err
 	}
+	defer secmem.Wipe(authJSON)
 
-	data, err := crypter.Encrypt(authJSON, m.masterPassword)
+	// every save gets a new revision so that an older copy of
+	// the auth data can't replace it unnoticed
+	bc := &blobContext{VaultID: m.authVaultID, Role: roleAuth, Revision: m.authRevision + 1}
+	data, err := crypter.Seal(authJSON, m.masterKey.Bytes(), m.masterSalt, bc.dump())
 	if err != nil {
 		term.Errorf("Error encrypting auth data, this must be a bug: %s\n", err)
 		return err
 	}
 
-	filename := getAuthDataFilename()
-	err = ioutil.WriteFile(getAuthDataFilename(), data, os.FileMode(0600))
+	err = m.authStore.Save(data)
 	if err != nil {
-		term.Errorf("Error saving authentication file %s: %s\n", filename, err)
+		term.Errorf("Error saving auth data to %s: %s\n", m.authStore, err)
 	} else {
-		term.Successf("Authentication file saved successfully\n")
+		m.legacyAuth = false
+		m.migrateAuth = false
+		m.authRevision = bc.Revision
+		m.recordAuthRevision(m.authStore.String(), m.authRevision)
+		term.Successf("Auth data saved successfully to %s\n", m.authStore)
 	}
 
 	return err
 }
 
-func (m *Manager) loadWebdavAuth() (AuthData, error) {
-	var ad AuthData
+// checkAuthContext makes sure the data is an auth data file and not another
+// blob encrypted with the master password, the context is returned if so
+func checkAuthContext(context []byte) (*blobContext, error) {
+	bc := new(blobContext)
+	err := json.Unmarshal(context, bc)
+	if err != nil {
+		return nil, err
+	}
+	if bc.Role != roleAuth {
+		return nil, fmt.Errorf("the file is a %s file, not an auth data file", bc.Role)
+	}
+	return bc, nil
+}
+
+// checkAuthRevision refuses auth data older than the one seen last time.
+// Auth data with no context at all predates revisions, it's refused once
+// auth data with a context has been seen, otherwise it's migrated if the
+// user agrees.
+func (m *Manager) checkAuthRevision(bc *blobContext) error {
+	lastSeen, seen := m.state.AuthRevisions[m.authStore.String()]
+	if bc == nil {
+		if seen {
+			term.Errorf("Auth data in %s is in an older format than the one seen last time (revision %d)\n", m.authStore, lastSeen)
+			fmt.Printf(`
+The auth data may have been replaced with an older copy. If you restored it
+from a backup on purpose, remove the "%s" auth revision from %s
+and restart yanpassword to migrate it.`+"\n\n", m.authStore, getStateFilename())
+			return errAuthRefused
+		}
+		term.Warnf("Auth data in %s has no authenticated context and revision, it was created by an older version\n", m.authStore)
+		if !confirm("Migrate it to the current format?") {
+			return errAuthRefused
+		}
+		m.migrateAuth = true
+		return nil
+	}
+
+	if seen && bc.Revision < lastSeen {
+		term.Errorf("Auth data revision %d is older than revision %d seen last time\n", bc.Revision, lastSeen)
+		fmt.Printf(`
+The auth data in %s may have been replaced with an older copy. If you
+restored it from a backup on purpose, remove its auth revision from %s
+and restart yanpassword.`+"\n\n", m.authStore, getStateFilename())
+		return errAuthRefused
+	}
+	m.authRevision = bc.Revision
+	m.authVaultID = bc.VaultID
+	m.recordAuthRevision(m.authStore.String(), m.authRevision)
+	return nil
+}
 
-	f, err := os.Open(getAuthDataFilename())
+// bindAuthVault binds the auth data to the vault once the vault has been
+// saved with an id, auth data bound to another vault is reported
+func (m *Manager) bindAuthVault() {
+	if m.authVaultID == m.vaultID || m.revision == 0 {
+		return
+	}
+	if m.authVaultID != "" {
+		term.Warnf("Auth data in %s belongs to vault %s, not to vault %s loaded\n", m.authStore, m.authVaultID, m.vaultID)
+		return
+	}
+	if m.authStore.ReadOnly() {
+		return
+	}
+	m.authVaultID = m.vaultID
+	err := m.saveWevdavAuth(m.webdavAuthData)
 	if err != nil {
-		term.Errorf("Error opening auth data file: %s\n", err)
-		return ad, err
+		m.authVaultID = ""
 	}
-	defer f.Close()
+}
 
-	data, err := ioutil.ReadAll(f)
+func (m *Manager) loadWebdavAuth() (AuthData, error) {
+	var ad AuthData
+
+	data, err := m.authStore.Load()
 	if err != nil {
-		term.Errorf("Error loading auth data file: %s\n", err)
+		term.Errorf("Error loading auth data from %s: %s\n", m.authStore, err)
 		return ad, err
 	}
 
-	authJSON, err := crypter.Decrypt(data, m.masterPassword)
+	var authJSON []byte
+	if crypter.IsLegacy(data) {
+		if _, seen := m.state.AuthRevisions[m.authStore.String()]; seen {
+			term.Errorf("Auth data in %s is in legacy format while the current format has been seen before\n", m.authStore)
+			return ad, errAuthRefused
+		}
+		authJSON, err = m.decryptLegacy(data, m.masterPassword.Bytes(), "Auth data file")
+		if err == nil {
+			m.legacyAuth = true
+			// the auth data file is going to be re-encrypted with a new salt
+			err = m.deriveMasterKey(nil)
+		}
+	} else {
+		var salt []byte
+		salt, err = crypter.Salt(data)
+		if err == nil {
+			err = m.deriveMasterKey(salt)
+		}
+		if err == nil {
+			var context []byte
+			authJSON, context, err = crypter.Open(data, m.masterKey.Bytes())
+			if err == nil {
+				var bc *blobContext
+				if context != nil {
+					bc, err = checkAuthContext(context)
+				}
+				if err == nil {
+					err = m.checkAuthRevision(bc)
+				}
+			}
+		}
+	}
 	if err != nil {
-		term.Errorf("Error decrypting auth data file: %s\n", err)
+		if err != errLegacyRefused && err != errAuthRefused {
+			term.Errorf("Error decrypting auth data file: %s\n", err)
+		}
 		return ad, err
 	}
+	defer secmem.Wipe(authJSON)
+
 	err = json.Unmarshal(authJSON, &ad)
 	if err != nil {
 		term.Errorf("Error unmarshalling auth data file: %s\n", err)
@@ -0,0 +1,186 @@
+package manager
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/secmem"
+)
+
+// newAuthTestManager returns a manager with a file auth store and
+// the state file in a temporary home directory
+func newAuthTestManager(t *testing.T) (*Manager, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "yanpassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+
+	m := newTestManager(t)
+	m.authStore = &fileAuthStore{filename: filepath.Join(dir, "auth")}
+	m.state, err = loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.masterPassword, err = secmem.NewFrom([]byte("master password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.deriveMasterKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m, func() {
+		os.Setenv("HOME", home)
+		os.RemoveAll(dir)
+	}
+}
+
+// withStdin answers the prompts with the input given
+func withStdin(input string) func() {
+	saved := stdin
+	stdin = bufio.NewReader(strings.NewReader(input))
+	return func() { stdin = saved }
+}
+
+// sealV2 encrypts the data the way auth data was encrypted before
+// the authenticated context was added to the format
+func sealV2(t *testing.T, data []byte, key []byte, salt []byte) []byte {
+	t.Helper()
+	header := append([]byte("YNPW\x02"), salt...)
+	ciphertext, err := crypter.EncryptWithKeyAD(data, key, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(header, ciphertext...)
+}
+
+func TestAuthDataRevision(t *testing.T) {
+	m, cleanup := newAuthTestManager(t)
+	defer cleanup()
+
+	ad := AuthData{Username: "user", Password: "password"}
+	err := m.saveWevdavAuth(ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := m.authStore.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.saveWevdavAuth(ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.authRevision != 2 || m.state.AuthRevisions[m.authStore.String()] != 2 {
+		t.Fatalf("auth revision %d, state %v after two saves", m.authRevision, m.state.AuthRevisions)
+	}
+
+	loaded, err := m.loadWebdavAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Username != "user" || m.authRevision != 2 {
+		t.Fatalf("loaded %v at revision %d", loaded, m.authRevision)
+	}
+
+	// an older copy of the auth data
+	err = m.authStore.Save(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.loadWebdavAuth()
+	if err != errAuthRefused {
+		t.Fatalf("loading an older revision returned %v, want %v", err, errAuthRefused)
+	}
+}
+
+func TestAuthDataV2Migration(t *testing.T) {
+	m, cleanup := newAuthTestManager(t)
+	defer cleanup()
+
+	authJSON := []byte(`{"username":"user","password":"password"}`)
+	err := m.authStore.Save(sealV2(t, authJSON, m.masterKey.Bytes(), m.masterSalt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restore := withStdin("n\n")
+	_, err = m.loadWebdavAuth()
+	restore()
+	if err != errAuthRefused {
+		t.Fatalf("declined migration returned %v, want %v", err, errAuthRefused)
+	}
+
+	restore = withStdin("y\n")
+	ad, err := m.loadWebdavAuth()
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ad.Username != "user" || !m.migrateAuth {
+		t.Fatalf("loaded %v, migrate %v", ad, m.migrateAuth)
+	}
+	err = m.saveWevdavAuth(ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := m.authStore.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, context, err := crypter.Open(data, m.masterKey.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := checkAuthContext(context)
+	if err != nil || bc.Revision != 1 {
+		t.Fatalf("migrated auth data context %s, %v", context, err)
+	}
+
+	// the v2 copy is refused without asking once v3 has been seen
+	err = m.authStore.Save(sealV2(t, authJSON, m.masterKey.Bytes(), m.masterSalt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore = withStdin("y\n")
+	_, err = m.loadWebdavAuth()
+	restore()
+	if err != errAuthRefused {
+		t.Fatalf("loading a downgraded file returned %v, want %v", err, errAuthRefused)
+	}
+}
+
+func TestBindAuthVault(t *testing.T) {
+	m, cleanup := newAuthTestManager(t)
+	defer cleanup()
+
+	m.webdavAuthData = AuthData{Username: "user", Password: "password"}
+	m.bindAuthVault()
+	if m.authVaultID != "" {
+		t.Fatal("auth data bound to a vault never saved")
+	}
+
+	m.revision = 1
+	m.bindAuthVault()
+	if m.authVaultID != m.vaultID {
+		t.Fatalf("auth data bound to %q, want %q", m.authVaultID, m.vaultID)
+	}
+	m.authVaultID = ""
+	_, err := m.loadWebdavAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.authVaultID != m.vaultID {
+		t.Fatalf("loaded auth data bound to %q, want %q", m.authVaultID, m.vaultID)
+	}
+}
@@ -0,0 +1,321 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/viert/yanpassword/term"
+)
+
+const (
+	authStoreFile          = "file"
+	authStoreKeyctl        = "keyctl"
+	authStoreSecretService = "secret-service"
+	authStoreEnv           = "env"
+	authStoreFD            = "fd"
+
+	authKeyDescription = "yanpassword:auth"
+	authEnvVariable    = "YANPASSWORD_AUTH"
+)
+
+var (
+	errAuthStoreReadOnly = errors.New("auth data store is read-only")
+)
+
+// requireWritableAuthStore explains how to update auth data kept in
+// a read-only store, errAuthStoreReadOnly is returned for such stores
+func (m *Manager) requireWritableAuthStore(reason string) error {
+	if !m.authStore.ReadOnly() {
+		return nil
+	}
+	term.Errorf("%s, but %s is read-only.\n", reason, m.authStore)
+	fmt.Printf(`
+Run yanpassword once with the auth data in a writable store, e.g. the default
+file store (put the decoded data to ~/.yanpasswd_auth and remove auth_store
+from %s), then export it again with base64 -w0 ~/.yanpasswd_auth`+"\n\n", getConfigFilename())
+	return errAuthStoreReadOnly
+}
+
+// authStore is a place where the encrypted auth data lives
+type authStore interface {
+	Exists() (bool, error)
+	Load() ([]byte, error)
+	Save(data []byte) error
+	// ReadOnly returns true if Save always fails with errAuthStoreReadOnly
+	ReadOnly() bool
+	String() string
+}
+
+func newAuthStore(cfg *Config) (authStore, error) {
+	switch cfg.AuthStore {
+	case "", authStoreFile:
+		return &fileAuthStore{filename: expandHome(cfg.AuthFile)}, nil
+	case authStoreKeyctl:
+		return &keyctlAuthStore{file: &fileAuthStore{filename: expandHome(cfg.AuthFile)}}, nil
+	case authStoreSecretService:
+		return new(secretServiceAuthStore), nil
+	case authStoreEnv:
+		return new(envAuthStore), nil
+	case authStoreFD:
+		return &fdAuthStore{fd: cfg.AuthFD}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth store %s", cfg.AuthStore)
+	}
+}
+
+// fileAuthStore keeps the auth data in a local file
+type fileAuthStore struct {
+	filename string
+}
+
+func (s *fileAuthStore) Exists() (bool, error) {
+	_, err := os.Stat(s.filename)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (s *fileAuthStore) Load() ([]byte, error) {
+	return ioutil.ReadFile(s.filename)
+}
+
+func (s *fileAuthStore) Save(data []byte) error {
+	return ioutil.WriteFile(s.filename, data, os.FileMode(0600))
+}
+
+func (s *fileAuthStore) ReadOnly() bool {
+	return false
+}
+
+func (s *fileAuthStore) String() string {
+	return "file " + s.filename
+}
+
+// keyctlAuthStore caches the auth data in the Linux kernel keyring. Kernel
+// keyrings don't survive a reboot so the auth data file is kept as well and
+// the keyring is filled from it when the key is gone.
+type keyctlAuthStore struct {
+	file *fileAuthStore
+}
+
+// keyring returns the user persistent keyring which outlives login sessions,
+// the user keyring is used if the kernel has no persistent keyrings
+func (s *keyctlAuthStore) keyring() string {
+	out, err := exec.Command("keyctl", "get_persistent", "@u").Output()
+	if err != nil {
+		return "@u"
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (s *keyctlAuthStore) keyID() (string, error) {
+	out, err := exec.Command("keyctl", "search", s.keyring(), "user", authKeyDescription).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (s *keyctlAuthStore) cache(data []byte) error {
+	cmd := exec.Command("keyctl", "padd", "user", authKeyDescription, s.keyring())
+	cmd.Stdin = bytes.NewReader(data)
+	_, err := cmd.Output()
+	return err
+}
+
+func (s *keyctlAuthStore) Exists() (bool, error) {
+	if _, err := exec.LookPath("keyctl"); err != nil {
+		return false, err
+	}
+	if _, err := s.keyID(); err == nil {
+		return true, nil
+	}
+	return s.file.Exists()
+}
+
+func (s *keyctlAuthStore) Load() ([]byte, error) {
+	if id, err := s.keyID(); err == nil {
+		return exec.Command("keyctl", "pipe", id).Output()
+	}
+	data, err := s.file.Load()
+	if err != nil {
+		return nil, err
+	}
+	// the file is the source of truth, failing to cache it is not an error
+	s.cache(data)
+	return data, nil
+}
+
+func (s *keyctlAuthStore) Save(data []byte) error {
+	err := s.file.Save(data)
+	if err != nil {
+		return err
+	}
+	// the data is saved once it's in the file, the keyring is only a cache
+	// refilled from the file on next load
+	err = s.cache(data)
+	if err != nil {
+		term.Warnf("Error caching auth data in the kernel keyring: %s\n", err)
+		s.uncache()
+	}
+	return nil
+}
+
+// uncache removes the cached key so that stale auth data
+// isn't loaded instead of the file
+func (s *keyctlAuthStore) uncache() {
+	id, err := s.keyID()
+	if err != nil {
+		return
+	}
+	err = exec.Command("keyctl", "unlink", id, s.keyring()).Run()
+	if err != nil {
+		term.Warnf("Error removing stale auth data from the kernel keyring, remove key %s manually: %s\n", id, err)
+	}
+}
+
+func (s *keyctlAuthStore) ReadOnly() bool {
+	return false
+}
+
+func (s *keyctlAuthStore) String() string {
+	return "kernel keyring key " + authKeyDescription + " backed by " + s.file.String()
+}
+
+// secretServiceAuthStore keeps the auth data in a Secret Service
+// provider like GNOME Keyring or KWallet via secret-tool
+type secretServiceAuthStore struct{}
+
+var secretServiceAttrs = []string{"application", "yanpassword", "type", "auth"}
+
+// lookup returns the stored secret. secret-tool exits with status 1 and
+// prints nothing if there's no such item, any other failure like a locked
+// keyring or no D-Bus session is an error, not a missing item.
+func (s *secretServiceAuthStore) lookup() ([]byte, bool, error) {
+	args := append([]string{"lookup"}, secretServiceAttrs...)
+	out, err := exec.Command("secret-tool", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr := bytes.TrimSpace(exitErr.Stderr)
+			if exitErr.ExitCode() == 1 && len(stderr) == 0 {
+				return nil, false, nil
+			}
+			if len(stderr) > 0 {
+				return nil, false, fmt.Errorf("secret-tool lookup failed: %s", stderr)
+			}
+		}
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+func (s *secretServiceAuthStore) Exists() (bool, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return false, err
+	}
+	_, found, err := s.lookup()
+	return found, err
+}
+
+func (s *secretServiceAuthStore) Load() ([]byte, error) {
+	out, found, err := s.lookup()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s not found", s)
+	}
+	// secret-tool stores text secrets so the data is base64-encoded
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
+
+func (s *secretServiceAuthStore) Save(data []byte) error {
+	args := append([]string{"store", "--label=Yanpassword auth data"}, secretServiceAttrs...)
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = strings.NewReader(base64.StdEncoding.EncodeToString(data))
+	_, err := cmd.Output()
+	return err
+}
+
+func (s *secretServiceAuthStore) ReadOnly() bool {
+	return false
+}
+
+func (s *secretServiceAuthStore) String() string {
+	return "secret service item " + strings.Join(secretServiceAttrs, " ")
+}
+
+// envAuthStore reads base64-encoded auth data from an environment variable
+type envAuthStore struct{}
+
+func (s *envAuthStore) Exists() (bool, error) {
+	return os.Getenv(authEnvVariable) != "", nil
+}
+
+func (s *envAuthStore) Load() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(os.Getenv(authEnvVariable)))
+}
+
+func (s *envAuthStore) Save(data []byte) error {
+	return errAuthStoreReadOnly
+}
+
+func (s *envAuthStore) ReadOnly() bool {
+	return true
+}
+
+func (s *envAuthStore) String() string {
+	return "environment variable " + authEnvVariable
+}
+
+// fdAuthStore reads auth data from an inherited file descriptor.
+// The descriptor can be read only once so the data is cached.
+type fdAuthStore struct {
+	fd   int
+	data []byte
+}
+
+func (s *fdAuthStore) Exists() (bool, error) {
+	return s.fd > 2, nil
+}
+
+func (s *fdAuthStore) Load() ([]byte, error) {
+	if s.data != nil {
+		return s.data, nil
+	}
+
+	f := os.NewFile(uintptr(s.fd), fmt.Sprintf("fd%d", s.fd))
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", s.fd)
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	s.data = data
+	return data, nil
+}
+
+func (s *fdAuthStore) Save(data []byte) error {
+	return errAuthStoreReadOnly
+}
+
+func (s *fdAuthStore) ReadOnly() bool {
+	return true
+}
+
+func (s *fdAuthStore) String() string {
+	return fmt.Sprintf("file descriptor %d", s.fd)
+}
@@ -0,0 +1,127 @@
+package manager
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileAuthStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yanpassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &fileAuthStore{filename: filepath.Join(dir, "auth")}
+	if exists, err := s.Exists(); err != nil || exists {
+		t.Fatalf("Exists() = %v, %v before saving", exists, err)
+	}
+	err = s.Save([]byte("auth data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := s.Load()
+	if err != nil || !bytes.Equal(data, []byte("auth data")) {
+		t.Fatalf("Load() = %q, %v", data, err)
+	}
+	if st, _ := os.Stat(s.filename); st.Mode().Perm() != 0600 {
+		t.Errorf("auth data file mode %s", st.Mode())
+	}
+}
+
+func TestEnsureKeyPairReadOnlyStore(t *testing.T) {
+	m := newTestManager(t)
+	m.authStore = new(envAuthStore)
+	m.webdavAuthData = AuthData{Username: "user", Password: "password"}
+
+	err := m.ensureKeyPair()
+	if err != errAuthStoreReadOnly {
+		t.Fatalf("ensureKeyPair() = %v, want %v", err, errAuthStoreReadOnly)
+	}
+	if m.webdavAuthData.PublicKey != nil {
+		t.Error("a key pair generated for a read-only store")
+	}
+}
+
+// fakeTool puts a script running the body first in PATH
+func fakeTool(t *testing.T, dir string, name string, body string) func() {
+	t.Helper()
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body+"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return func() { os.Setenv("PATH", path) }
+}
+
+func TestSecretServiceExists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yanpassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		body   string
+		exists bool
+		fails  bool
+	}{
+		{"echo YXV0aA==", true, false},
+		{"exit 1", false, false},
+		{"echo 'secret-tool: Cannot autolaunch D-Bus without X11 $DISPLAY' >&2; exit 1", false, true},
+	} {
+		restore := fakeTool(t, dir, "secret-tool", tc.body)
+		exists, err := new(secretServiceAuthStore).Exists()
+		restore()
+		if exists != tc.exists || (err != nil) != tc.fails {
+			t.Errorf("Exists() = %v, %v with secret-tool %q", exists, err, tc.body)
+		}
+	}
+}
+
+func TestKeyctlSaveCacheFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yanpassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a stale key is cached and caching the new data fails
+	unlinked := filepath.Join(dir, "unlinked")
+	restore := fakeTool(t, dir, "keyctl", `case "$1" in
+search) echo 42 ;;
+unlink) echo "$2" > `+unlinked+` ;;
+*) exit 1 ;;
+esac`)
+	defer restore()
+
+	s := &keyctlAuthStore{file: &fileAuthStore{filename: filepath.Join(dir, "auth")}}
+	err = s.Save([]byte("auth data"))
+	if err != nil {
+		t.Fatalf("Save() = %v with the file saved", err)
+	}
+	data, err := s.file.Load()
+	if err != nil || string(data) != "auth data" {
+		t.Fatalf("auth file holds %q, %v", data, err)
+	}
+	id, err := ioutil.ReadFile(unlinked)
+	if err != nil || strings.TrimSpace(string(id)) != "42" {
+		t.Errorf("stale key not unlinked: %q, %v", id, err)
+	}
+}
+
+func TestFirstRunReadOnlyStore(t *testing.T) {
+	m := newTestManager(t)
+	m.authStore = new(envAuthStore)
+	os.Unsetenv(authEnvVariable)
+
+	err := m.acquireAuthData()
+	if err != errAuthStoreReadOnly {
+		t.Fatalf("acquireAuthData() = %v, want %v", err, errAuthStoreReadOnly)
+	}
+}
@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/viert/yanpassword/hibp"
+	"github.com/viert/yanpassword/term"
+)
+
+// breachedEntry is a service with a password seen in data breaches
+type breachedEntry struct {
+	si    *ServiceInfo
+	count int
+}
+
+// openBreachList opens the local Pwned Passwords list, the path
+// falls back to the hibp_path setting
+func (m *Manager) openBreachList(path string) (hibp.List, error) {
+	if path == "" {
+		path = m.config.HIBPPath
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no Pwned Passwords list configured, set hibp_path in %s or use --path", getConfigFilename())
+	}
+	list, err := hibp.Open(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("error opening Pwned Passwords list: %s", err)
+	}
+	return list, nil
+}
+
+// breachedEntries checks every service password against the list
+func (m *Manager) breachedEntries(list hibp.List) ([]*breachedEntry, error) {
+	breached := make([]*breachedEntry, 0)
+	for _, name := range m.serviceNames() {
+		si, _ := m.lookup(name)
+		secret, err := m.revealSecret(si)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting service %s: %s", si.Name, err)
+		}
+		if secret.Password == "" {
+			continue
+		}
+
+		count, err := list.Count(hibp.Sum([]byte(secret.Password)))
+		if err != nil {
+			return nil, fmt.Errorf("error checking service %s: %s", si.Name, err)
+		}
+		if count > 0 {
+			breached = append(breached, &breachedEntry{si, count})
+		}
+	}
+	return breached, nil
+}
+
+func (m *Manager) doBreachCheck(name string, argsLine string, args ...string) {
+	ca, err := parseArgs(args, "path=")
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+
+	list, err := m.openBreachList(ca.get("path"))
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	defer list.Close()
+
+	breached, err := m.breachedEntries(list)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	if len(breached) == 0 {
+		term.Successf("None of the passwords was found in data breaches\n")
+		return
+	}
+
+	width := 0
+	for _, be := range breached {
+		if len(be.si.Name) > width {
+			width = len(be.si.Name)
+		}
+	}
+	for _, be := range breached {
+		fmt.Printf("%-*s  %s\n", width, be.si.Name, term.Red(fmt.Sprintf("seen %d times in data breaches", be.count)))
+	}
+	fmt.Println()
+	term.Warnf("%d compromised passwords found, change them as soon as possible\n", len(breached))
+}
@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/viert/yanpassword/strength"
+)
+
+const (
+	configFilename    = ".yanpasswd.conf"
+	configEnvVariable = "YANPASSWORD_CONFIG"
+	authFilename      = ".yanpasswd_auth"
+)
+
+// Config represents yanpassword settings stored in ~/.yanpasswd.conf
+// or in a file set by YANPASSWORD_CONFIG environment variable
+type Config struct {
+	// RefuseLegacyCrypto disables decrypting data encrypted by older versions
+	// of yanpassword, i.e. data without a format header
+	RefuseLegacyCrypto bool `json:"refuse_legacy_crypto"`
+	// AuthStore is where the encrypted auth data lives:
+	// file, keyctl, secret-service, env or fd
+	AuthStore string `json:"auth_store"`
+	// AuthFile is the auth data file path for the file auth store
+	AuthFile string `json:"auth_file"`
+	// AuthFD is the file descriptor to read auth data from for the fd auth store
+	AuthFD int `json:"auth_fd"`
+	// TrashRetention is how long deleted entries are kept in trash,
+	// e.g. 30d or 12w, or never to keep them until empty-trash
+	TrashRetention string `json:"trash_retention"`
+	// MinPasswordScore is the minimum strength score (0-4) of service passwords
+	MinPasswordScore int `json:"min_password_score"`
+	// AllowWeakPasswords lets the user keep a service password below
+	// MinPasswordScore after a confirmation instead of rejecting it
+	AllowWeakPasswords bool `json:"allow_weak_passwords"`
+	// MinMasterPasswordScore is the minimum strength score (0-4) of the master password
+	MinMasterPasswordScore int `json:"min_master_password_score"`
+	// HIBPPath is the local Pwned Passwords list, either a file
+	// of hashes ordered by hash or a directory of range files
+	HIBPPath string `json:"hibp_path"`
+	// ClipboardTimeout is how long copied secrets stay on the clipboard, 0 keeps them
+	ClipboardTimeout string `json:"clipboard_timeout"`
+	// ClipboardProvider forces the clipboard provider: osc52, wl-copy, xclip or xsel
+	ClipboardProvider string `json:"clipboard_provider"`
+	// ClipboardClearUnverified clears the clipboard after the timeout even if
+	// the provider can't read it back to check it still holds the copied value
+	ClipboardClearUnverified bool `json:"clipboard_clear_unverified"`
+	// DisablePasswordRecovery keeps the vault data key from being sealed
+	// with the master password in the vault
+	DisablePasswordRecovery bool `json:"disable_password_recovery"`
+}
+
+func getConfigFilename() string {
+	if filename := os.Getenv(configEnvVariable); filename != "" {
+		return filename
+	}
+	return path.Join(os.Getenv("HOME"), configFilename)
+}
+
+// expandHome replaces the leading ~ of a path with the user's home directory
+func expandHome(filename string) string {
+	if filename == "~" || strings.HasPrefix(filename, "~/") {
+		return path.Join(os.Getenv("HOME"), filename[1:])
+	}
+	return filename
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		AuthStore:              authStoreFile,
+		AuthFile:               path.Join("~", authFilename),
+		TrashRetention:         defaultTrashRetention,
+		MinMasterPasswordScore: defaultMinMasterPasswordScore,
+		ClipboardTimeout:       defaultClipboardTimeout,
+	}
+}
+
+func loadConfig() (*Config, error) {
+	cfg := defaultConfig()
+
+	data, err := ioutil.ReadFile(getConfigFilename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) validate() error {
+	for _, score := range []struct {
+		name  string
+		value int
+	}{
+		{"min_password_score", cfg.MinPasswordScore},
+		{"min_master_password_score", cfg.MinMasterPasswordScore},
+	} {
+		if score.value < strength.VeryWeak || score.value > strength.Strong {
+			return fmt.Errorf("invalid %s %d, the score is %d to %d", score.name, score.value, strength.VeryWeak, strength.Strong)
+		}
+	}
+	if _, err := parseRetention(cfg.TrashRetention); err != nil {
+		return fmt.Errorf("invalid trash_retention %q: %s, use e.g. 30d or %s", cfg.TrashRetention, err, trashKeepForever)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package manager
+
+import "testing"
+
+func TestConfigValidateScores(t *testing.T) {
+	cfg := defaultConfig()
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("default config is invalid: %s", err)
+	}
+
+	for _, score := range []int{-1, 5} {
+		cfg := defaultConfig()
+		cfg.MinPasswordScore = score
+		if cfg.validate() == nil {
+			t.Errorf("min_password_score %d accepted", score)
+		}
+		cfg = defaultConfig()
+		cfg.MinMasterPasswordScore = score
+		if cfg.validate() == nil {
+			t.Errorf("min_master_password_score %d accepted", score)
+		}
+	}
+}
+
+func TestConfigValidateTrashRetention(t *testing.T) {
+	for _, retention := range []string{"30d", "12w", "36h", trashKeepForever} {
+		cfg := defaultConfig()
+		cfg.TrashRetention = retention
+		if err := cfg.validate(); err != nil {
+			t.Errorf("trash_retention %s rejected: %s", retention, err)
+		}
+	}
+	for _, retention := range []string{"", "forever", "30", "-5d", "0d"} {
+		cfg := defaultConfig()
+		cfg.TrashRetention = retention
+		if cfg.validate() == nil {
+			t.Errorf("trash_retention %q accepted", retention)
+		}
+	}
+}
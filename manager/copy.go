@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/viert/yanpassword/clipboard"
+	"github.com/viert/yanpassword/term"
+)
+
+const (
+	defaultClipboardTimeout = "30s"
+	copyFieldPassword       = "password"
+	copyFieldUsername       = "username"
+	copyFieldURL            = "url"
+	copyFieldTOTP           = "totp"
+	copyFieldNote           = "note"
+)
+
+// getClipboard returns the clipboard creating it on first use
+func (m *Manager) getClipboard() (*clipboard.Clipboard, error) {
+	if m.clipboard != nil {
+		return m.clipboard, nil
+	}
+
+	var provider clipboard.Provider
+	var err error
+	if m.config.ClipboardProvider != "" {
+		provider, err = clipboard.New(m.config.ClipboardProvider)
+	} else {
+		provider, err = clipboard.Detect()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no clipboard available: %s", err)
+	}
+
+	m.clipboard = clipboard.NewClipboard(provider)
+	m.clipboard.ClearUnverified = m.config.ClipboardClearUnverified
+	m.clipboard.OnClear = func(cleared bool, err error) {
+		// readline redraws the prompt after the output
+		out := m.rl.Stdout()
+		switch {
+		case err != nil:
+			fmt.Fprintln(out, term.Red(fmt.Sprintf("Error clearing the clipboard: %s", err)))
+		case cleared:
+			fmt.Fprintln(out, term.Green("Clipboard cleared"))
+		default:
+			fmt.Fprintln(out, term.Yellow("Clipboard has changed since copying, left intact"))
+		}
+	}
+	return m.clipboard, nil
+}
+
+// clearClipboard clears a value waiting to be cleared, it's called on exit
+func (m *Manager) clearClipboard() {
+	if m.clipboard == nil || !m.clipboard.Pending() {
+		return
+	}
+	cleared, err := m.clipboard.Clear()
+	if err != nil {
+		term.Errorf("Error clearing the clipboard: %s\n", err)
+	} else if cleared {
+		term.Successf("Clipboard cleared\n")
+	}
+}
+
+// copyableFields returns the names of the entry values copy accepts
+func (si *ServiceInfo) copyableFields() []string {
+	names := make([]string, 0)
+	if tmpl := si.template(); tmpl != nil {
+		for _, tf := range tmpl.Fields {
+			names = append(names, tf.Name)
+		}
+	} else if si.isNote() {
+		names = append(names, copyFieldNote)
+	} else {
+		names = append(names, copyFieldPassword, copyFieldUsername)
+	}
+	names = append(names, copyFieldURL, copyFieldTOTP)
+	for name := range si.Fields {
+		names = append(names, name)
+	}
+
+	// typed entries keep their fields in the custom fields too
+	sort.Strings(names)
+	unique := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// fieldValue returns an entry value by its field name,
+// the primary secret if the name is empty
+func fieldValue(si *ServiceInfo, secret *serviceSecret, field string) (string, error) {
+	if field == "" {
+		return primaryValue(si, secret), nil
+	}
+
+	if tmpl := si.template(); tmpl != nil {
+		for _, tf := range tmpl.Fields {
+			if tf.Name == field {
+				return templateValue(si, secret, tf), nil
+			}
+		}
+	}
+	if cf, found := si.Fields[field]; found {
+		if cf.isSecret() {
+			return secret.Fields[field], nil
+		}
+		return cf.Value, nil
+	}
+
+	switch field {
+	case copyFieldPassword:
+		return secret.Password, nil
+	case copyFieldUsername:
+		return si.Username, nil
+	case copyFieldURL:
+		return si.URL, nil
+	case copyFieldNote:
+		return secret.Note, nil
+	case copyFieldTOTP:
+		if secret.TOTP == "" {
+			return "", nil
+		}
+		code, _, err := totpCode(secret.TOTP, time.Now())
+		return code, err
+	}
+	return "", fmt.Errorf("service %s has no field %s", si.Name, field)
+}
+
+func (m *Manager) doClipboardCopy(name string, argsLine string, args ...string) {
+	if len(args) < 1 || args[0] == "" {
+		term.Errorf("Use copy <service> [field]\n")
+		return
+	}
+
+	serviceName := args[0]
+	si, found := m.lookup(serviceName)
+	if !found {
+		term.Errorf("Service %s not found\n", serviceName)
+		return
+	}
+	field := ""
+	if len(args) > 1 {
+		field = args[1]
+	}
+
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+		return
+	}
+	value, err := fieldValue(si, secret, field)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	if value == "" {
+		term.Errorf("Nothing to copy, the value is empty\n")
+		return
+	}
+
+	if field == "" {
+		field = "secret"
+	}
+	m.copyToClipboard([]byte(value), fmt.Sprintf("%s of %s", field, si.Name))
+}
+
+// copyToClipboard copies the value to be cleared after clipboard_timeout,
+// what is the description of the value used in messages
+func (m *Manager) copyToClipboard(value []byte, what string) {
+	timeout, err := parseAge(m.config.ClipboardTimeout)
+	if err != nil {
+		term.Errorf("Invalid clipboard_timeout setting: %s\n", err)
+		return
+	}
+
+	cb, err := m.getClipboard()
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	err = cb.Copy(value, timeout)
+	if err != nil {
+		term.Errorf("Error copying to the clipboard: %s\n", err)
+		return
+	}
+
+	switch {
+	case cb.Pending():
+		term.Successf("Copied the %s to the clipboard with %s, it's cleared in %s\n", what, cb.Provider().Name(), timeout)
+	case timeout > 0:
+		term.Successf("Copied the %s to the clipboard with %s\n", what, cb.Provider().Name())
+		term.Warnf("The clipboard can't be read back with %s so it's left intact, set clipboard_clear_unverified to clear it anyway\n", cb.Provider().Name())
+	default:
+		term.Successf("Copied the %s to the clipboard with %s\n", what, cb.Provider().Name())
+	}
+}
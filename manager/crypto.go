@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"errors"
+
+	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/term"
+)
+
+var (
+	errLegacyRefused = errors.New("legacy decryption is disabled")
+	errAuthRefused   = errors.New("auth data is refused")
+)
+
+// decryptLegacy decrypts data encrypted by older versions of yanpassword
+// unless legacy decryption is disabled in config
+func (m *Manager) decryptLegacy(data []byte, passwd []byte, what string) ([]byte, error) {
+	if m.config.RefuseLegacyCrypto {
+		term.Errorf(
+			"%s is encrypted in legacy format and legacy decryption is disabled in %s\n",
+			what,
+			getConfigFilename(),
+		)
+		return nil, errLegacyRefused
+	}
+
+	decrypted, usedMD5, err := crypter.DecryptLegacy(data, passwd)
+	if err != nil {
+		return nil, err
+	}
+
+	if usedMD5 {
+		term.Warnf("%s is encrypted in legacy format with a plain MD5 key.\n", what)
+	} else {
+		term.Warnf("%s is encrypted in legacy format.\n", what)
+	}
+	term.Warnf("Use **upgrade-crypto** command to re-encrypt it.\n")
+	return decrypted, nil
+}
+
+func (m *Manager) doUpgradeCrypto(name string, argsLine string, args ...string) {
+	if !m.legacyAuth && !m.legacyPassdb {
+		term.Successf("Nothing to upgrade, all the data is encrypted in the current format\n")
+		return
+	}
+
+	if m.legacyAuth {
+		if m.requireWritableAuthStore("Auth data has to be re-encrypted") != nil {
+			return
+		}
+		if m.saveWevdavAuth(m.webdavAuthData) != nil {
+			return
+		}
+	}
+
+	if m.legacyPassdb {
+		err := m.savePassdb()
+		if err != nil {
+			term.Errorf("Error saving yanpassword data: %s\n", err)
+			return
+		}
+		term.Successf("Yanpassword data re-encrypted\n")
+	}
+}
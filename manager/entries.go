@@ -0,0 +1,184 @@
+package manager
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/viert/yanpassword/term"
+)
+
+// newEntryID generates a random (version 4) UUID
+func newEntryID() (string, error) {
+	id := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, id)
+	if err != nil {
+		return "", err
+	}
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]), nil
+}
+
+// indexByID re-keys entries by their ids generating ids for
+// entries created before ids were introduced
+func indexByID(entries serviceData) (serviceData, error) {
+	var err error
+	sd := make(serviceData)
+	for _, si := range entries {
+		if si.ID == "" {
+			si.ID, err = newEntryID()
+			if err != nil {
+				return nil, err
+			}
+		}
+		sd[si.ID] = si
+	}
+	return sd, nil
+}
+
+// reindex rebuilds the name index of entries
+func (m *Manager) reindex() {
+	m.names = make(map[string]string)
+	for id, si := range m.data {
+		if prevID, found := m.names[si.Name]; found {
+			term.Warnf("Duplicate service name %s, ids %s and %s\n", si.Name, prevID, id)
+			continue
+		}
+		m.names[si.Name] = id
+	}
+}
+
+// lookup finds an entry by its name
+func (m *Manager) lookup(name string) (*ServiceInfo, bool) {
+	id, found := m.names[name]
+	if !found {
+		return nil, false
+	}
+	si, found := m.data[id]
+	return si, found
+}
+
+// put adds an entry or replaces an entry with the same id
+func (m *Manager) put(si *ServiceInfo) error {
+	var err error
+	if si.ID == "" {
+		si.ID, err = newEntryID()
+		if err != nil {
+			return err
+		}
+	}
+	if prev, found := m.data[si.ID]; found && prev.Name != si.Name {
+		delete(m.names, prev.Name)
+	}
+	m.data[si.ID] = si
+	m.names[si.Name] = si.ID
+	return nil
+}
+
+func (m *Manager) remove(si *ServiceInfo) {
+	delete(m.data, si.ID)
+	delete(m.names, si.Name)
+}
+
+func (m *Manager) rename(si *ServiceInfo, name string) {
+	delete(m.names, si.Name)
+	si.Name = name
+	m.names[name] = si.ID
+}
+
+// serviceNames returns sorted names of all the entries
+func (m *Manager) serviceNames() []string {
+	names := make([]string, 0, len(m.names))
+	for name := range m.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *Manager) doRename(name string, argsLine string, args ...string) {
+	if len(args) < 2 {
+		term.Errorf("Use %s <service> <new name>\n", name)
+		return
+	}
+
+	si, found := m.lookup(args[0])
+	if !found {
+		term.Errorf("Service %s not found\n", args[0])
+		return
+	}
+	if _, found := m.lookup(args[1]); found {
+		term.Errorf("Service %s already exists\n", args[1])
+		return
+	}
+
+	m.rename(si, args[1])
+	si.touch()
+	term.Successf("Service %s renamed to %s. Don't forget to **save** the result.\n", args[0], args[1])
+}
+
+func (m *Manager) doCopy(name string, argsLine string, args ...string) {
+	if len(args) < 2 {
+		term.Errorf("Use %s <service> <new name>\n", name)
+		return
+	}
+
+	src, found := m.lookup(args[0])
+	if !found {
+		term.Errorf("Service %s not found\n", args[0])
+		return
+	}
+	if _, found := m.lookup(args[1]); found {
+		term.Errorf("Service %s already exists\n", args[1])
+		return
+	}
+
+	secret, err := m.revealSecret(src)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", src.Name, err)
+		return
+	}
+
+	dst := &ServiceInfo{
+		Name:     args[1],
+		Type:     src.Type,
+		Username: src.Username,
+		Comment:  src.Comment,
+		URL:      src.URL,
+		Folder:   src.Folder,
+		Tags:     append([]string{}, src.Tags...),
+
+		PasswordChangedAt: src.PasswordChangedAt,
+		RotateEvery:       src.RotateEvery,
+		ExpiresAt:         src.ExpiresAt,
+	}
+	for _, att := range src.Attachments {
+		// blobs are immutable so the copy shares them
+		copied := *att
+		dst.Attachments = append(dst.Attachments, &copied)
+	}
+	if src.Fields != nil {
+		dst.Fields = make(map[string]*customField)
+		for k, v := range src.Fields {
+			field := *v
+			dst.Fields[k] = &field
+		}
+	}
+
+	// the copy gets its own entry key
+	err = m.setSecret(dst, secret)
+	if err != nil {
+		term.Errorf("Error encrypting service %s: %s\n", dst.Name, err)
+		return
+	}
+	dst.touch()
+
+	err = m.put(dst)
+	if err != nil {
+		term.Errorf("Error adding service %s: %s\n", dst.Name, err)
+		return
+	}
+	term.Successf("Service %s copied to %s. Don't forget to **save** the result.\n", src.Name, dst.Name)
+}
@@ -0,0 +1,205 @@
+package manager
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/viert/yanpassword/term"
+)
+
+// Custom field types
+const (
+	fieldText   = "text"
+	fieldSecret = "secret"
+	fieldURL    = "url"
+	fieldEmail  = "email"
+	fieldDate   = "date"
+
+	fieldDateFormat = "2006-01-02"
+	maskedValue     = "********"
+)
+
+var (
+	fieldTypes = []string{fieldText, fieldSecret, fieldURL, fieldEmail, fieldDate}
+)
+
+// customField is an arbitrary typed field of a service. Values of secret
+// fields are kept in the service secret, not in the index.
+type customField struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+	extra unknownFields
+}
+
+func (f *customField) isSecret() bool {
+	return f.Type == fieldSecret
+}
+
+func normalizeFieldType(ftype string) (string, error) {
+	ftype = strings.ToLower(ftype)
+	if ftype == "concealed" {
+		return fieldSecret, nil
+	}
+	for _, t := range fieldTypes {
+		if t == ftype {
+			return ftype, nil
+		}
+	}
+	return "", fmt.Errorf("unknown field type %s, valid types are %s", ftype, strings.Join(fieldTypes, ", "))
+}
+
+func validateField(ftype string, value string) error {
+	switch ftype {
+	case fieldURL:
+		u, err := url.Parse(value)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s is not an absolute URL", value)
+		}
+	case fieldEmail:
+		_, err := mail.ParseAddress(value)
+		if err != nil {
+			return err
+		}
+	case fieldDate:
+		_, err := time.Parse(fieldDateFormat, value)
+		if err != nil {
+			return fmt.Errorf("%s is not a date in YYYY-MM-DD format", value)
+		}
+	}
+	return nil
+}
+
+func sortedFieldNames(fields map[string]*customField) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printFields prints custom fields of a service, secret fields are masked unless reveal is set
+func printFields(si *ServiceInfo, secret *serviceSecret, reveal bool) {
+	tmpl := si.template()
+	for _, name := range sortedFieldNames(si.Fields) {
+		if tmpl != nil && tmpl.has(name) {
+			// printed by printTemplate
+			continue
+		}
+		field := si.Fields[name]
+		value := field.Value
+		if field.isSecret() {
+			value = secret.Fields[name]
+			if !reveal {
+				value = maskedValue
+			}
+		}
+		printValue(name, value)
+	}
+}
+
+// setField prompts for a custom field type and value, an empty value removes the field.
+// Fields of typed entries are set with their template type.
+func (m *Manager) setField(si *ServiceInfo, fieldName string) {
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", si.Name, err)
+		return
+	}
+	if tmpl := si.template(); tmpl != nil {
+		if tf := tmpl.field(fieldName); tf != nil {
+			m.setTemplateField(si, secret, tf)
+			return
+		}
+	}
+
+	ftype := fieldText
+	if field, found := si.Fields[fieldName]; found {
+		ftype = field.Type
+	}
+
+	for {
+		input, err := getString(fmt.Sprintf("Type (%s) [%s]: ", strings.Join(fieldTypes, "/"), ftype))
+		if err != nil {
+			return
+		}
+		if input == "" {
+			break
+		}
+		ftype, err = normalizeFieldType(input)
+		if err == nil {
+			break
+		}
+		term.Errorf("%s\n", err)
+	}
+
+	var value string
+	for {
+		if ftype == fieldSecret {
+			pwd, err := m.rl.ReadPassword("Value: ")
+			if err != nil {
+				return
+			}
+			value, err = expandText(string(pwd), secret.Fields[fieldName])
+			if err != nil {
+				term.Errorf("%s\n", err)
+				return
+			}
+		} else {
+			current := ""
+			if field, found := si.Fields[fieldName]; found {
+				current = field.Value
+			}
+			value, err = getText("Value: ", current)
+			if err != nil {
+				return
+			}
+		}
+		if value == "" {
+			break
+		}
+		err = validateField(ftype, value)
+		if err == nil {
+			break
+		}
+		term.Errorf("Invalid %s value: %s\n", ftype, err)
+	}
+
+	delete(secret.Fields, fieldName)
+	if value == "" {
+		delete(si.Fields, fieldName)
+	} else {
+		if si.Fields == nil {
+			si.Fields = make(map[string]*customField)
+		}
+		if ftype == fieldSecret {
+			if secret.Fields == nil {
+				secret.Fields = make(map[string]string)
+			}
+			secret.Fields[fieldName] = value
+			si.Fields[fieldName] = &customField{Type: ftype}
+		} else {
+			si.Fields[fieldName] = &customField{Type: ftype, Value: value}
+		}
+	}
+
+	err = m.setSecret(si, secret)
+	if err != nil {
+		term.Errorf("Error encrypting service %s: %s\n", si.Name, err)
+		return
+	}
+	si.touch()
+
+	if value == "" {
+		term.Successf("Field %s removed. Don't forget to **save** the result.\n", fieldName)
+	} else {
+		term.Successf("Field %s set. Don't forget to **save** the result.\n", fieldName)
+	}
+}
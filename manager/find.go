@@ -0,0 +1,276 @@
+package manager
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/viert/yanpassword/term"
+)
+
+const (
+	maxFindResults    = 20
+	maxSuggestions    = 9
+	maxSnippetLength  = 50
+	scoreExact        = 100
+	scorePrefix       = 80
+	scoreWordStart    = 70
+	scoreSubstring    = 60
+	scoreSubsequence  = 40
+	minSubsequenceLen = 2
+)
+
+// searchField is a non-secret entry value the search looks into
+type searchField struct {
+	name   string
+	value  string
+	weight int
+}
+
+// searchFields returns the entry values to search, secrets are never included
+func (si *ServiceInfo) searchFields() []*searchField {
+	fields := []*searchField{
+		{"name", si.Name, 3},
+		{"username", si.Username, 2},
+		{"url", si.URL, 2},
+		{"folder", si.Folder, 1},
+		{"tags", strings.Join(si.Tags, " "), 1},
+		{"type", si.Type, 1},
+		{"comment", si.Comment, 1},
+	}
+
+	names := make([]string, 0, len(si.Fields))
+	for name := range si.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field := si.Fields[name]
+		value := name
+		if !field.isSecret() {
+			value += " " + field.Value
+		}
+		fields = append(fields, &searchField{name, value, 1})
+	}
+
+	for _, att := range si.Attachments {
+		fields = append(fields, &searchField{"attachment", att.Name, 1})
+	}
+	return fields
+}
+
+// fuzzyScore scores how well the value matches the word: exact matches go
+// first, then prefixes, substrings and finally the word letters found in
+// the value in order, the closer together the better
+func fuzzyScore(value string, word string) int {
+	v := []rune(strings.ToLower(value))
+	t := []rune(strings.ToLower(word))
+	if len(t) == 0 || len(v) == 0 {
+		return 0
+	}
+
+	sv, st := string(v), string(t)
+	switch idx := strings.Index(sv, st); {
+	case sv == st:
+		return scoreExact
+	case idx == 0:
+		return scorePrefix
+	case idx > 0 && strings.ContainsAny(sv[idx-1:idx], " ./-_@:"):
+		return scoreWordStart
+	case idx > 0:
+		return scoreSubstring
+	}
+
+	if len(t) < minSubsequenceLen {
+		return 0
+	}
+	ti, run, score := 0, 0, 0
+	for i := 0; i < len(v) && ti < len(t); i++ {
+		if v[i] == t[ti] {
+			ti++
+			run++
+			score += run
+		} else {
+			run = 0
+		}
+	}
+	if ti < len(t) {
+		return 0
+	}
+	// contiguous letters give the maximum of 1+2+...+len(t)
+	best := len(t) * (len(t) + 1) / 2
+	return 1 + (scoreSubsequence-1)*score/best
+}
+
+type findResult struct {
+	si    *ServiceInfo
+	score int
+	// field is the best matching field other than the name
+	field *searchField
+}
+
+// matcher scores a single field value, 0 means no match
+type matcher func(value string) int
+
+// find ranks the entries by the matchers, an entry matches if every
+// matcher matches at least one of its fields
+func (m *Manager) find(matchers []matcher, namesOnly bool) []*findResult {
+	results := make([]*findResult, 0)
+	for _, si := range m.data {
+		fields := si.searchFields()
+		if namesOnly {
+			fields = fields[:1]
+		}
+
+		res := &findResult{si: si}
+		bestField := 0
+		for _, match := range matchers {
+			best := 0
+			for _, f := range fields {
+				score := match(f.value) * f.weight
+				if score > best {
+					best = score
+				}
+				if f.name != "name" && score > bestField {
+					bestField = score
+					res.field = f
+				}
+			}
+			if best == 0 {
+				res = nil
+				break
+			}
+			res.score += best
+		}
+		if res != nil {
+			results = append(results, res)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].si.Name < results[j].si.Name
+	})
+	return results
+}
+
+func fuzzyMatchers(query []string) []matcher {
+	matchers := make([]matcher, len(query))
+	for i, word := range query {
+		word := word
+		matchers[i] = func(value string) int { return fuzzyScore(value, word) }
+	}
+	return matchers
+}
+
+func regexMatchers(expr string) ([]matcher, error) {
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return nil, err
+	}
+	return []matcher{func(value string) int {
+		if re.MatchString(value) {
+			return scoreSubstring
+		}
+		return 0
+	}}, nil
+}
+
+func snippet(f *searchField) string {
+	value := strings.SplitN(f.value, "\n", 2)[0]
+	if r := []rune(value); len(r) > maxSnippetLength {
+		value = string(r[:maxSnippetLength]) + "..."
+	}
+	return f.name + ": " + value
+}
+
+func printResults(results []*findResult) {
+	width := 0
+	for _, res := range results {
+		if len(res.si.Name) > width {
+			width = len(res.si.Name)
+		}
+	}
+	for i, res := range results {
+		line := fmt.Sprintf("%2d  %-*s", i+1, width, res.si.Name)
+		if res.field != nil {
+			line += "  " + term.Blue(snippet(res.field))
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
+
+// pickResult prompts to pick one of the results by its number,
+// an empty input picks nothing
+func pickResult(results []*findResult, prompt string) (*ServiceInfo, bool) {
+	for {
+		input, err := getString(prompt)
+		if err != nil || input == "" {
+			return nil, false
+		}
+		n, err := strconv.Atoi(input)
+		if err == nil && n >= 1 && n <= len(results) {
+			return results[n-1].si, true
+		}
+		term.Errorf("Type a number from 1 to %d\n", len(results))
+	}
+}
+
+// suggestService offers services with names similar to the one not found
+func (m *Manager) suggestService(serviceName string) (*ServiceInfo, bool) {
+	results := m.find(fuzzyMatchers(strings.Fields(serviceName)), true)
+	if len(results) == 0 {
+		term.Errorf("Service %s not found\n", serviceName)
+		return nil, false
+	}
+	if len(results) > maxSuggestions {
+		results = results[:maxSuggestions]
+	}
+
+	term.Warnf("Service %s not found, did you mean:\n", serviceName)
+	printResults(results)
+	return pickResult(results, "Service number (Enter to cancel): ")
+}
+
+func (m *Manager) doFind(name string, argsLine string, args ...string) {
+	ca, err := parseArgs(args, "regex")
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	if len(ca.positional) < 1 {
+		term.Errorf("Use find <query> or find --regex <expression>\n")
+		return
+	}
+
+	var matchers []matcher
+	if ca.has("regex") {
+		matchers, err = regexMatchers(strings.Join(ca.positional, " "))
+		if err != nil {
+			term.Errorf("Invalid regular expression: %s\n", err)
+			return
+		}
+	} else {
+		matchers = fuzzyMatchers(ca.positional)
+	}
+
+	results := m.find(matchers, false)
+	if len(results) == 0 {
+		term.Errorf("Nothing found\n")
+		return
+	}
+	if len(results) > maxFindResults {
+		fmt.Printf("Showing %d best of %d matches\n", maxFindResults, len(results))
+		results = results[:maxFindResults]
+	}
+
+	printResults(results)
+	si, picked := pickResult(results, "Show service number (Enter to skip): ")
+	if picked {
+		m.doGet("get", si.Name, si.Name)
+	}
+}
@@ -0,0 +1,206 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/viert/yanpassword/passgen"
+	"github.com/viert/yanpassword/term"
+)
+
+const (
+	generateValue = "!gen"
+)
+
+var (
+	genOptions = []string{
+		"length=", "words=", "separator=",
+		"lower", "upper", "digits", "symbols", "require", "ambiguous",
+		"no-lower", "no-upper", "no-digits", "no-symbols", "no-require", "no-ambiguous",
+	}
+)
+
+// genPolicy applies command line options to a copy of the base policy
+func genPolicy(ca *cmdArgs, base *passgen.Policy) (*passgen.Policy, error) {
+	p := *base
+
+	if ca.has("length") {
+		length, err := strconv.Atoi(ca.get("length"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid length %s", ca.get("length"))
+		}
+		p.Length = length
+		p.Words = 0
+	}
+	if ca.has("words") {
+		words, err := strconv.Atoi(ca.get("words"))
+		if err != nil || words < 1 {
+			return nil, fmt.Errorf("invalid number of words %s", ca.get("words"))
+		}
+		p.Words = words
+	}
+	if ca.has("separator") {
+		p.Separator = ca.get("separator")
+	}
+	if p.Length == 0 {
+		p.Length = passgen.DefaultLength
+	}
+
+	// --opt turns a setting of the base policy on and --no-opt turns it off
+	ambiguous := !p.ExcludeAmbiguous
+	for _, flag := range []struct {
+		name  string
+		value *bool
+	}{
+		{"lower", &p.Lower},
+		{"upper", &p.Upper},
+		{"digits", &p.Digits},
+		{"symbols", &p.Symbols},
+		{"require", &p.RequireEach},
+		{"ambiguous", &ambiguous},
+	} {
+		on, off := ca.has(flag.name), ca.has("no-"+flag.name)
+		if on && off {
+			return nil, fmt.Errorf("options --%s and --no-%s conflict", flag.name, flag.name)
+		}
+		if on || off {
+			*flag.value = on
+		}
+	}
+	p.ExcludeAmbiguous = !ambiguous
+
+	err := p.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// generatorPolicy returns the generator policy of the first tag of the entry
+// having one (in alphabetical order), the default policy otherwise
+func (m *Manager) generatorPolicy(si *ServiceInfo) *passgen.Policy {
+	if si != nil {
+		tags := make([]string, len(si.Tags))
+		copy(tags, si.Tags)
+		sort.Strings(tags)
+		for _, tag := range tags {
+			if p, found := m.policies[tag]; found && p.Generate != nil {
+				return p.Generate
+			}
+		}
+	}
+	return passgen.DefaultPolicy()
+}
+
+// expandPassword generates a password if the input is !gen optionally
+// followed by gen options, otherwise the input is returned as is.
+// The generated password is only shown with --show and copied with --copy.
+func (m *Manager) expandPassword(si *ServiceInfo, input string) (string, error) {
+	tokens := strings.Fields(input)
+	if len(tokens) == 0 || tokens[0] != generateValue {
+		return input, nil
+	}
+
+	ca, err := parseArgs(tokens[1:], append(genOptions, "show", "copy")...)
+	if err != nil {
+		return "", err
+	}
+	p, err := genPolicy(ca, m.generatorPolicy(si))
+	if err != nil {
+		return "", err
+	}
+	pwd, err := passgen.Generate(p)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Password generated, %.0f bits of entropy\n", p.Entropy())
+	if ca.has("show") {
+		fmt.Printf("Generated password: %s\n", pwd)
+	}
+	if ca.has("copy") {
+		m.copyToClipboard([]byte(pwd), "generated password")
+	}
+	return pwd, nil
+}
+
+// getPassword prompts for a password, !gen generates one. The password
+// strength is shown and the prompt repeats if it's too weak
+// unless the user chooses to keep it.
+func (m *Manager) getPassword(si *ServiceInfo, prompt string) (string, error) {
+	for {
+		input, err := getString(prompt)
+		if err != nil {
+			return "", err
+		}
+		pwd, err := m.expandPassword(si, input)
+		if err != nil {
+			return "", err
+		}
+		if pwd == "" || m.acceptPassword(si, []byte(pwd)) {
+			return pwd, nil
+		}
+	}
+}
+
+func (m *Manager) doGen(name string, argsLine string, args ...string) {
+	ca, err := parseArgs(args, append(genOptions, "tag=")...)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+
+	base := passgen.DefaultPolicy()
+	if ca.has("tag") {
+		tp, found := m.policies[ca.get("tag")]
+		if !found || tp.Generate == nil {
+			term.Errorf("Tag %s has no generator policy\n", ca.get("tag"))
+			return
+		}
+		base = tp.Generate
+	}
+
+	p, err := genPolicy(ca, base)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	pwd, err := passgen.Generate(p)
+	if err != nil {
+		term.Errorf("Error generating password: %s\n", err)
+		return
+	}
+	fmt.Println(pwd)
+	fmt.Printf("%s, %.0f bits of entropy\n", p, p.Entropy())
+}
+
+func (m *Manager) policyGen(args ...string) {
+	if len(args) < 2 {
+		term.Errorf("Use policy gen <tag> <options|off>, e.g. policy gen bank --length 16 --no-symbols\n")
+		return
+	}
+
+	tag := args[0]
+	if args[1] == rotationOff {
+		m.policy(tag).Generate = nil
+		m.policy(tag).generateExtra = nil
+		m.cleanupPolicy(tag)
+		term.Successf("Generator policy of tag %s removed. Don't forget to **save** the result.\n", tag)
+		return
+	}
+
+	ca, err := parseArgs(args[1:], genOptions...)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	p, err := genPolicy(ca, passgen.DefaultPolicy())
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	m.policy(tag).Generate = p
+	m.policy(tag).generateExtra = nil
+	term.Successf("Passwords generated for services tagged %s are %s. Don't forget to **save** the result.\n", tag, p)
+}
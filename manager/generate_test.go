@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/viert/yanpassword/passgen"
+)
+
+func TestGenPolicyFlags(t *testing.T) {
+	base := passgen.DefaultPolicy()
+	base.Symbols = false
+	base.ExcludeAmbiguous = true
+
+	ca, err := parseArgs([]string{"--symbols", "--no-digits", "--ambiguous"}, genOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := genPolicy(ca, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Symbols || p.Digits || p.ExcludeAmbiguous || !p.Lower || !p.Upper {
+		t.Errorf("unexpected policy %s", p)
+	}
+	if base.Symbols || !base.ExcludeAmbiguous {
+		t.Error("the base policy has been modified")
+	}
+
+	ca, err = parseArgs([]string{"--symbols", "--no-symbols"}, genOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = genPolicy(ca, base); err == nil {
+		t.Error("conflicting options accepted")
+	}
+}
+
+// captureStdout returns what f prints to the standard output
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	f()
+	os.Stdout = saved
+	w.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestExpandPasswordHidden(t *testing.T) {
+	m := newTestManager(t)
+	si := &ServiceInfo{Name: "github"}
+
+	var pwd string
+	var err error
+	out := captureStdout(t, func() { pwd, err = m.expandPassword(si, "!gen --length 32") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pwd) != 32 || strings.Contains(out, pwd) {
+		t.Errorf("generated %q, printed %q", pwd, out)
+	}
+
+	out = captureStdout(t, func() { pwd, err = m.expandPassword(si, "!gen --show") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pwd == "" || !strings.Contains(out, pwd) {
+		t.Errorf("generated %q not shown with --show, printed %q", pwd, out)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"os"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/viert/yanpassword/term"
 )
@@ -20,12 +22,37 @@ func (m *Manager) setupHandlers() {
 	m.handlers["ls"] = m.doList
 	m.handlers["get"] = m.doGet
 	m.handlers["getpass"] = m.doGet
+	m.handlers["find"] = m.doFind
+	m.handlers["copy"] = m.doClipboardCopy
 	m.handlers["set"] = m.doSet
 	m.handlers["setpass"] = m.doSet
 	m.handlers["delete"] = m.doDelete
 	m.handlers["remove"] = m.doDelete
 	m.handlers["del"] = m.doDelete
 	m.handlers["rm"] = m.doDelete
+	m.handlers["trash"] = m.doTrash
+	m.handlers["undelete"] = m.doUndelete
+	m.handlers["empty-trash"] = m.doEmptyTrash
+	m.handlers["rename"] = m.doRename
+	m.handlers["mv"] = m.doRename
+	m.handlers["cp"] = m.doCopy
+	m.handlers["note"] = m.doNote
+	m.handlers["attach"] = m.doAttach
+	m.handlers["attachments"] = m.doAttachments
+	m.handlers["extract"] = m.doExtract
+	m.handlers["detach"] = m.doDetach
+	m.handlers["totp"] = m.doTOTP
+	m.handlers["history"] = m.doHistory
+	m.handlers["revert"] = m.doRevert
+	m.handlers["expiring"] = m.doExpiring
+	m.handlers["gen"] = m.doGen
+	m.handlers["audit"] = m.doAudit
+	m.handlers["breachcheck"] = m.doBreachCheck
+	m.handlers["policy"] = m.doPolicy
+	m.handlers["member"] = m.doMember
+	m.handlers["upgrade-crypto"] = m.doUpgradeCrypto
+	m.handlers["chpass"] = m.doChpass
+	m.handlers["verify"] = m.doVerify
 }
 
 func (m *Manager) doExit(name string, argsLine string, args ...string) {
@@ -57,7 +84,14 @@ func (m *Manager) doImport(name string, argsLine string, args ...string) {
 		return
 	}
 
-	sd := make(serviceData)
+	if isOTPList(data) {
+		added, skipped := m.importOTPList(data)
+		term.Successf("%d TOTP secrets imported, %d skipped\n", added, skipped)
+		term.Warnf("The imported data is not persistent yet, don't forget to **save** it.\n")
+		return
+	}
+
+	sd := make(plainServiceData)
 	err = json.Unmarshal(data, &sd)
 	if err != nil {
 		term.Errorf("error parsing file %s: %s\n", filename, err)
@@ -67,12 +101,36 @@ func (m *Manager) doImport(name string, argsLine string, args ...string) {
 	added := 0
 	skipped := 0
 	for k, v := range sd {
-		if _, found := m.data[k]; found {
-			term.Warnf("Service %s already exists, skipping\n", k)
+		si := v.info()
+		if si.Name == "" {
+			si.Name = k
+		}
+		if _, found := m.lookup(si.Name); found {
+			term.Warnf("Service %s already exists, skipping\n", si.Name)
+			skipped++
+			continue
+		}
+		_, inData := m.data[si.ID]
+		_, inTrash := m.trash[si.ID]
+		if inData || inTrash {
+			// the same entry imported under another name
+			si.ID = ""
+		}
+		if si.UpdatedAt == "" {
+			si.touch()
+		} else if si.CreatedAt == "" {
+			// the entry is at least as old as its last modification
+			si.CreatedAt = si.UpdatedAt
+		}
+		err = m.setSecret(si, v.secret())
+		if err == nil {
+			err = m.put(si)
+		}
+		if err != nil {
+			term.Errorf("Error importing service %s: %s\n", si.Name, err)
 			skipped++
 			continue
 		}
-		m.data[k] = v
 		added++
 	}
 
@@ -83,9 +141,16 @@ func (m *Manager) doImport(name string, argsLine string, args ...string) {
 func (m *Manager) doExport(name string, argsLine string, args ...string) {
 	if len(args) < 1 {
 		term.Errorf("Use export <filename> to export data to a json file\n")
+		return
 	}
 
-	data, err := m.data.dump()
+	pd, err := m.plainData()
+	if err != nil {
+		term.Errorf("Error decrypting data: %s\n", err)
+		return
+	}
+
+	data, err := json.Marshal(pd)
 	if err != nil {
 		term.Errorf("Error marshaling data: %s\n", err)
 		return
@@ -99,23 +164,105 @@ func (m *Manager) doExport(name string, argsLine string, args ...string) {
 	}
 
 	term.Successf("Data has been successfully exported to file %s\n", filename)
+	for _, si := range m.data {
+		if len(si.Attachments) > 0 {
+			term.Warnf("Attachments are not exported, use extract to save them\n")
+			break
+		}
+	}
 }
 
 func (m *Manager) doList(name string, argsLine string, args ...string) {
-	if len(m.data) > 0 {
-		names := make([]string, len(m.data))
-		i := 0
-		for k := range m.data {
-			names[i] = k
-			i++
+	ca, err := parseArgs(args, "sort=", "older-than=", "tag=", "type=", "tree")
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+
+	folder := ""
+	if len(ca.positional) > 0 {
+		folder = normalizeFolder(ca.positional[0])
+	}
+	tag := ca.get("tag")
+	etype := ""
+	if ca.has("type") {
+		etype, err = normalizeEntryType(ca.get("type"))
+		if err != nil {
+			term.Errorf("%s\n", err)
+			return
 		}
-		sort.Strings(names)
+	}
 
-		for _, name := range names {
-			fmt.Println(name)
+	var threshold time.Time
+	olderThan := ca.has("older-than")
+	if olderThan {
+		age, err := parseAge(ca.get("older-than"))
+		if err != nil {
+			term.Errorf("%s\n", err)
+			return
+		}
+		threshold = time.Now().Add(-age)
+	}
+
+	items := make([]*ServiceInfo, 0, len(m.data))
+	width := 0
+	for _, si := range m.data {
+		if olderThan && !si.updatedTime().Before(threshold) {
+			continue
+		}
+		if folder != "" && !si.inFolder(folder) {
+			continue
 		}
-	} else {
+		if tag != "" && !si.hasTag(tag) {
+			continue
+		}
+		if etype != "" && si.entryType() != etype {
+			continue
+		}
+		items = append(items, si)
+		if len(si.Name) > width {
+			width = len(si.Name)
+		}
+	}
+
+	if len(items) == 0 {
 		term.Errorf("Empty list\n")
+		return
+	}
+
+	sortBy := ca.get("sort")
+	switch sortBy {
+	case "", "name":
+		sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	case "updated":
+		sort.Slice(items, func(i, j int) bool {
+			ti, tj := items[i].updatedTime(), items[j].updatedTime()
+			if ti.Equal(tj) {
+				return items[i].Name < items[j].Name
+			}
+			return ti.Before(tj)
+		})
+	default:
+		term.Errorf("Can't sort by %s, use --sort name or --sort updated\n", sortBy)
+		return
+	}
+
+	if ca.has("tree") {
+		printTree(items)
+		return
+	}
+
+	showUpdated := sortBy == "updated" || olderThan
+	for _, si := range items {
+		if showUpdated {
+			updated := "never"
+			if si.UpdatedAt != "" {
+				updated = displayTimestamp(si.UpdatedAt)
+			}
+			fmt.Printf("%-*s  %s\n", width, si.Name, updated)
+		} else {
+			fmt.Println(si.Name)
+		}
 	}
 }
 
@@ -125,43 +272,147 @@ func (m *Manager) doGet(name string, argsLine string, args ...string) {
 		return
 	}
 
-	serviceName := args[0]
-	if item, found := m.data[serviceName]; found {
+	ca, err := parseArgs(args, "reveal")
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	if len(ca.positional) < 1 {
+		term.Errorf("%s command requires a service name\n", name)
+		return
+	}
+
+	serviceName := ca.positional[0]
+	item, found := m.lookup(serviceName)
+	if !found {
+		item, found = m.suggestService(serviceName)
+	}
+	if found {
+		serviceName = item.Name
+		secret, err := m.revealSecret(item)
+		if err != nil {
+			term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+			return
+		}
+
 		switch name {
 		case "getpass":
-			fmt.Println(item.Password)
+			fmt.Println(primaryValue(item, secret))
 		default:
 			fmt.Printf("Service: %s\n", item.Name)
-			if item.Username != "" {
-				fmt.Printf("Username: %s\n", item.Username)
+			if item.isNote() {
+				printValue("Note", secret.Note)
 			}
-			if item.Password != "" {
-				fmt.Printf("Password: %s\n", item.Password)
+			if item.template() != nil {
+				fmt.Printf("Type: %s\n", item.Type)
+				printTemplate(item, secret, ca.has("reveal"))
+			} else {
+				if item.Username != "" {
+					fmt.Printf("Username: %s\n", item.Username)
+				}
+				if secret.Password != "" {
+					fmt.Printf("Password: %s\n", secret.Password)
+				}
 			}
 			if item.Comment != "" {
-				fmt.Printf("Comment: %s\n", item.Comment)
+				printValue("Comment", item.Comment)
 			}
 			if item.URL != "" {
 				fmt.Printf("URL: %s\n", item.URL)
 			}
+			if item.Folder != "" {
+				fmt.Printf("Folder: %s/\n", item.Folder)
+			}
+			if len(item.Tags) > 0 {
+				fmt.Printf("Tags: %s\n", strings.Join(item.Tags, ", "))
+			}
+			printFields(item, secret, ca.has("reveal"))
+			if secret.TOTP != "" {
+				code, remaining, err := totpCode(secret.TOTP, time.Now())
+				if err != nil {
+					term.Errorf("Error generating TOTP code: %s\n", err)
+				} else {
+					fmt.Printf("TOTP: %s (%ds remaining)\n", code, remaining/time.Second)
+				}
+			}
+			if len(item.Attachments) > 0 {
+				names := make([]string, len(item.Attachments))
+				for i, att := range item.Attachments {
+					names[i] = att.Name
+				}
+				fmt.Printf("Attachments: %s\n", strings.Join(names, ", "))
+			}
+			if item.RotateEvery != "" {
+				fmt.Printf("Rotate every: %s\n", item.RotateEvery)
+			}
+			if item.ExpiresAt != "" {
+				fmt.Printf("Expires: %s\n", item.ExpiresAt)
+			}
+			if due, ok := m.dueTime(item); ok {
+				fmt.Printf("Rotation: %s\n", formatDue(due, time.Now()))
+			}
+			if item.CreatedAt != "" {
+				fmt.Printf("Created: %s\n", displayTimestamp(item.CreatedAt))
+			}
+			if item.UpdatedAt != "" {
+				fmt.Printf("Updated: %s\n", displayTimestamp(item.UpdatedAt))
+			}
 			fmt.Println()
 		}
-	} else {
-		term.Errorf("Service %s not found\n", serviceName)
 	}
 }
 
 func (m *Manager) doSet(name string, argsLine string, args ...string) {
-	if len(args) < 1 {
+	ca, err := parseArgs(args, "type=")
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	if len(ca.positional) < 1 {
 		term.Errorf("%s command requires a service name\n", name)
 		return
 	}
 
-	serviceName := args[0]
+	serviceName := ca.positional[0]
+
+	if len(ca.positional) > 1 {
+		si, found := m.lookup(serviceName)
+		if !found {
+			term.Errorf("Service %s not found\n", serviceName)
+			return
+		}
+
+		subArgs := ca.positional[2:]
+		switch ca.positional[1] {
+		case "field":
+			if len(subArgs) < 1 {
+				term.Errorf("Use set <service> field <name> to set a custom field\n")
+				return
+			}
+			m.setField(si, subArgs[0])
+		case "folder":
+			m.setFolder(si, subArgs...)
+		case "tags":
+			m.setTags(si, subArgs...)
+		case "totp":
+			m.setTOTP(si)
+		case "rotate":
+			m.setRotation(si, subArgs...)
+		case "expires":
+			m.setExpiry(si, subArgs...)
+		default:
+			term.Errorf(
+				"Use set <service> to set the service data, set <service> field <name>, " +
+					"set <service> folder <path>, set <service> tags <tag,...>, set <service> totp, " +
+					"set <service> rotate <interval> or set <service> expires <date>\n",
+			)
+		}
+		return
+	}
 
 	switch name {
 	case "setpass":
-		si, found := m.data[serviceName]
+		si, found := m.lookup(serviceName)
 		if !found {
 			term.Errorf(
 				"Service %s not found. If you want to create it, use \"set\" command instead of setpass\n",
@@ -169,21 +420,120 @@ func (m *Manager) doSet(name string, argsLine string, args ...string) {
 			)
 			return
 		}
+		if si.isNote() {
+			term.Errorf("Service %s is a secure note, use note %s to edit it\n", serviceName, serviceName)
+			return
+		}
+		if tmpl := si.template(); tmpl != nil && !tmpl.has(templatePassword) {
+			term.Errorf(
+				"Service %s is a %s entry with no password, use set %s instead\n",
+				serviceName,
+				si.Type,
+				serviceName,
+			)
+			return
+		}
+
+		secret, err := m.revealSecret(si)
+		if err != nil {
+			term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+			return
+		}
 
-		pwd, err := getString("Password: ")
+		pwd, err := m.getPassword(si, "Password: ")
 		if err != nil {
+			term.Errorf("%s\n", err)
 			return
 		}
-		si.Password = pwd
+		si.setPassword(secret, pwd)
+
+		err = m.setSecret(si, secret)
+		if err != nil {
+			term.Errorf("Error encrypting service %s: %s\n", serviceName, err)
+			return
+		}
+		si.touch()
 		term.Successf("Password updated. Don't forget to **save** the result.\n")
 	default:
+		etype := ""
+		if ca.has("type") {
+			etype, err = normalizeEntryType(ca.get("type"))
+			if err != nil {
+				term.Errorf("%s\n", err)
+				return
+			}
+		}
+
 		si := &ServiceInfo{Name: serviceName}
-		si.Username, _ = getString("Username: ")
-		si.Password, _ = getString("Password: ")
-		si.Comment, _ = getString("Comment: ")
-		si.URL, _ = getString("URL: ")
-		m.data[serviceName] = si
-		term.Successf("Service %s created. Don't forget to **save** the result.\n", serviceName)
+		secret := new(serviceSecret)
+		prev, exists := m.lookup(serviceName)
+		if exists && prev.isNote() {
+			term.Errorf("Service %s is a secure note, use note %s to edit it\n", serviceName, serviceName)
+			return
+		}
+		if exists && etype != "" && etype != prev.entryType() {
+			term.Errorf("Service %s is a %s entry, its type can't be changed\n", serviceName, prev.entryType())
+			return
+		}
+		if !exists && etype == entryNote {
+			term.Errorf("Use note %s to create a secure note\n", serviceName)
+			return
+		}
+		if !exists && etype != entryLogin {
+			si.Type = etype
+		}
+		if exists {
+			var err error
+			// keep the metadata set by other commands
+			*si = *prev
+			secret, err = m.revealSecret(prev)
+			if err != nil {
+				term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+				return
+			}
+		}
+
+		if si.template() != nil {
+			err = m.setTyped(si, secret)
+			if err != nil {
+				term.Errorf("%s\n", err)
+				return
+			}
+		} else {
+			si.Username, _ = getString("Username: ")
+			pwd, err := m.getPassword(si, "Password: ")
+			if err != nil {
+				term.Errorf("%s\n", err)
+				return
+			}
+			si.setPassword(secret, pwd)
+			comment, err := getText("Comment: ", si.Comment)
+			if err != nil {
+				term.Errorf("%s\n", err)
+				return
+			}
+			si.Comment = comment
+			si.URL, _ = getString("URL: ")
+		}
+
+		err = m.setSecret(si, secret)
+		if err != nil {
+			term.Errorf("Error encrypting service %s: %s\n", serviceName, err)
+			return
+		}
+
+		si.touch()
+		err = m.put(si)
+		if err != nil {
+			term.Errorf("Error adding service %s: %s\n", serviceName, err)
+			return
+		}
+
+		if exists {
+			term.Successf("Service %s updated. Don't forget to **save** the result.\n", serviceName)
+		} else {
+			term.Successf("Service %s created. Don't forget to **save** the result.\n", serviceName)
+		}
 	}
 }
 
@@ -194,12 +544,12 @@ func (m *Manager) doDelete(name string, argsLine string, args ...string) {
 	}
 
 	serviceName := args[0]
-	_, found := m.data[serviceName]
+	si, found := m.lookup(serviceName)
 	if !found {
 		term.Errorf("Service %s not found.", serviceName)
 		return
 	}
 
-	delete(m.data, serviceName)
-	term.Successf("Service %s removed. Don't forget to **save** the result.\n", serviceName)
+	m.moveToTrash(si)
+	term.Successf("Service %s moved to trash. Don't forget to **save** the result.\n", serviceName)
 }
@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/viert/yanpassword/term"
+)
+
+func (m *Manager) doHistory(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		term.Errorf("%s command requires a service name\n", name)
+		return
+	}
+
+	serviceName := args[0]
+	si, found := m.lookup(serviceName)
+	if !found {
+		term.Errorf("Service %s not found\n", serviceName)
+		return
+	}
+
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+		return
+	}
+
+	if len(secret.History) == 0 {
+		term.Warnf("Service %s has no previous passwords\n", serviceName)
+		return
+	}
+
+	for i, record := range secret.History {
+		fmt.Printf("%2d  %s  %s\n", i+1, displayTimestamp(record.ChangedAt), record.Password)
+	}
+}
+
+func (m *Manager) doRevert(name string, argsLine string, args ...string) {
+	if len(args) < 2 {
+		term.Errorf("Use revert <service> <N> to restore the N-th previous password shown by history\n")
+		return
+	}
+
+	serviceName := args[0]
+	si, found := m.lookup(serviceName)
+	if !found {
+		term.Errorf("Service %s not found\n", serviceName)
+		return
+	}
+
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+		return
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 || n > len(secret.History) {
+		term.Errorf(
+			"Invalid history record number %s, service %s has %d previous passwords\n",
+			args[1],
+			serviceName,
+			len(secret.History),
+		)
+		return
+	}
+
+	// the restored password is removed from history while
+	// the current one goes to the top of it
+	pwd := secret.History[n-1].Password
+	secret.History = append(secret.History[:n-1], secret.History[n:]...)
+	si.setPassword(secret, pwd)
+
+	err = m.setSecret(si, secret)
+	if err != nil {
+		term.Errorf("Error encrypting service %s: %s\n", serviceName, err)
+		return
+	}
+	si.touch()
+	term.Successf("Password of %s reverted. Don't forget to **save** the result.\n", serviceName)
+}
@@ -2,50 +2,142 @@ package manager
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 
 	"github.com/chzyer/readline"
-	"github.com/viert/yanpassword/client"
-	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/clipboard"
+	"github.com/viert/yanpassword/secmem"
 	"github.com/viert/yanpassword/term"
 )
 
+// ServiceInfo is a passdb index entry, it keeps service metadata in the clear
+// while the service secrets are sealed with a separate entry key
 type ServiceInfo struct {
-	Name      string `json:"name"`
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	Comment   string `json:"comment"`
-	UpdatedAt string `json:"updated_at"`
-	URL       string `json:"url"`
+	ID        string                  `json:"id"`
+	Name      string                  `json:"name"`
+	Type      string                  `json:"type,omitempty"`
+	Username  string                  `json:"username"`
+	Comment   string                  `json:"comment"`
+	CreatedAt string                  `json:"created_at"`
+	UpdatedAt string                  `json:"updated_at"`
+	URL       string                  `json:"url"`
+	Folder    string                  `json:"folder,omitempty"`
+	Tags      []string                `json:"tags,omitempty"`
+	Fields    map[string]*customField `json:"fields,omitempty"`
+	// Attachments are kept in separate blobs, blob keys are sealed in the secret
+	Attachments []*attachment `json:"attachments,omitempty"`
+	// PasswordChangedAt is the time the current password was set at
+	PasswordChangedAt string `json:"password_changed_at,omitempty"`
+	// RotateEvery is the password rotation interval like 90d
+	RotateEvery string `json:"rotate_every,omitempty"`
+	// ExpiresAt is the date in YYYY-MM-DD format the entry expires on
+	ExpiresAt string `json:"expires_at,omitempty"`
+	// DeletedAt is set for entries in trash
+	DeletedAt string        `json:"deleted_at,omitempty"`
+	Secret    *sealedSecret `json:"secret"`
+	extra     unknownFields
 }
 
+// serviceData is a map of entries by their ids
 type serviceData map[string]*ServiceInfo
 
-func (s *serviceData) dump() ([]byte, error) {
-	return json.Marshal(s)
+// passdbIndex is the decrypted vault payload
+type passdbIndex struct {
+	Schema  int         `json:"schema"`
+	Meta    *vaultMeta  `json:"meta"`
+	Entries serviceData `json:"entries"`
+	Trash   serviceData `json:"trash,omitempty"`
+	// Policies are tag policies by tag names
+	Policies map[string]*tagPolicy `json:"tag_policies,omitempty"`
+	// OrphanBlobs are attachment blobs waiting to be deleted by the revision
+	// they were orphaned at
+	OrphanBlobs map[string]int64 `json:"orphan_blobs,omitempty"`
+	extra       unknownFields
 }
 
 type cmdHandler func(string, string, ...string)
 
 // Manager is the main exported class
 type Manager struct {
-	masterPassword string
+	masterPassword *secmem.Buffer
+	masterKey      *secmem.Buffer
+	masterSalt     []byte
+	privateKey     *secmem.Buffer
+	dataKey        *secmem.Buffer
+	keyGeneration  int
+	vaultID        string
+	revision       int64
 	data           serviceData
+	names          map[string]string
+	trash          serviceData
+	policies       map[string]*tagPolicy
+	schema         int
+	meta           *vaultMeta
+	indexExtra     unknownFields
+	vaultExtra     unknownFields
+	members        []*vaultMember
 	rl             *readline.Instance
 	stopped        bool
 	handlers       map[string]cmdHandler
 	webdavAuthData AuthData
+	config         *Config
+	state          *localState
+	authStore      authStore
+	legacyAuth     bool
+	legacyPassdb   bool
+	// migrateAuth is set when auth data predating revisions is to be re-saved
+	migrateAuth bool
+	// authRevision and authVaultID are bound to the auth data context
+	authRevision int64
+	authVaultID  string
+	// pendingBlobs are encrypted attachments to upload on save
+	pendingBlobs map[string][]byte
+	// storedBlobs are the uploaded attachments referenced by the vault
+	// as it was loaded or last saved
+	storedBlobs map[string]bool
+	// orphanBlobs are uploaded attachments no longer referenced by the vault,
+	// they are kept along with the revision they were orphaned at until no
+	// backup file refers to them
+	orphanBlobs map[string]int64
+	// clipboard is created on the first copy
+	clipboard *clipboard.Clipboard
 }
 
 // NewManager creates and initializes a new manager instance
 func NewManager() (*Manager, error) {
+	err := secmem.Harden()
+	if err != nil {
+		term.Warnf("Error disabling core dumps: %s\n", err)
+	}
+	secmem.OnLockError = func(err error) {
+		term.Warnf("Error locking key material in memory, it may be swapped out: %s\n", err)
+		term.Warnf("Raise the locked memory limit (ulimit -l) to keep it in RAM\n")
+	}
+
 	m := new(Manager)
+	m.config, err = loadConfig()
+	if err != nil {
+		term.Errorf("Error loading config file %s: %s\n", getConfigFilename(), err)
+		return nil, err
+	}
+
+	m.authStore, err = newAuthStore(m.config)
+	if err != nil {
+		term.Errorf("Error in config file %s: %s\n", getConfigFilename(), err)
+		return nil, err
+	}
+
+	m.state, err = loadState()
+	if err != nil {
+		term.Errorf("Error loading state file %s: %s\n", getStateFilename(), err)
+		return nil, err
+	}
+
 	m.setupHandlers()
-	err := m.setupReadline()
+	err = m.setupReadline()
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +147,7 @@ func NewManager() (*Manager, error) {
 // Start function gets auth data and starts the manager
 func (m *Manager) Start() error {
 	var err error
+	defer m.wipeKeys()
 
 	err = m.acquireAuthData()
 	if err != nil {
@@ -62,45 +155,26 @@ func (m *Manager) Start() error {
 	}
 
 	err = m.acquirePassdb()
+	m.masterPassword.Destroy()
+	m.masterPassword = nil
 	if err != nil {
 		return err
 	}
+	m.bindAuthVault()
+	m.reportOverdue()
 
 	m.setPrompt()
 	m.cmdLoop()
+	m.clearClipboard()
 
 	return nil
 }
 
-func (m *Manager) loadData(authData AuthData) error {
-	pdbc := client.NewPassdbClient(authData.Username, authData.Password)
-	encrypted, err := pdbc.Load()
-
-	if err != nil {
-		if client.Is404(err) {
-			m.data = make(serviceData)
-		} else {
-			fmt.Printf("Error reading data file: %s\n", err)
-			return err
-		}
-	} else {
-		// decrypt data
-		data, err := crypter.Decrypt(encrypted, m.masterPassword)
-		if err != nil {
-			// TODO: prompt for an optional remote-side password for the case
-			// it doesn't match the current master password. Next time being saved
-			// the data will be encrypted with the new one.
-
-			fmt.Printf("Error decrypting data file: %s\n", err)
-			return err
-		}
-		err = json.Unmarshal(data, &m.data)
-		if err != nil {
-			fmt.Printf("Error unmarshalling data file: %s\n", err)
-			return err
-		}
-	}
-	return nil
+func (m *Manager) wipeKeys() {
+	m.masterPassword.Destroy()
+	m.masterKey.Destroy()
+	m.privateKey.Destroy()
+	m.dataKey.Destroy()
 }
 
 func (m *Manager) cmdLoop() {
@@ -147,10 +221,23 @@ func (m *Manager) cmd(line string) {
 	}
 }
 
+// stdin is shared by all the prompts so that lines pasted at once
+// aren't lost in the buffer of a single prompt
+var stdin = bufio.NewReader(os.Stdin)
+
 func getString(prompt string) (string, error) {
 	fmt.Print(prompt)
-	rd := bufio.NewReader(os.Stdin)
-	data, err := rd.ReadString('\n')
+	data, err := stdin.ReadString('\n')
 	data = strings.TrimSpace(data)
 	return data, err
 }
+
+// confirm asks a yes/no question, anything but y or yes means no
+func confirm(prompt string) bool {
+	input, err := getString(prompt + " [y/N]: ")
+	if err != nil {
+		return false
+	}
+	input = strings.ToLower(input)
+	return input == "y" || input == "yes"
+}
@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/secmem"
+)
+
+// newTestManager creates a manager with an open empty vault
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	dataKey, err := crypter.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{config: defaultConfig(), data: make(serviceData), trash: make(serviceData)}
+	m.dataKey, err = secmem.NewFrom(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.vaultID, err = newVaultID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.reindex()
+	return m
+}
+
+// addTestService adds a service with the password
+func addTestService(t *testing.T, m *Manager, name string, password string) *ServiceInfo {
+	t.Helper()
+	si := &ServiceInfo{Name: name}
+	err := m.setSecret(si, &serviceSecret{Password: password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	si.touch()
+	err = m.put(si)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return si
+}
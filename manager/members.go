@@ -0,0 +1,160 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/secmem"
+	"github.com/viert/yanpassword/term"
+)
+
+var (
+	memberSubcommands = []string{"add", "remove", "list"}
+)
+
+func encodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func decodeKey(key string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != crypter.KeySize {
+		return nil, fmt.Errorf("invalid key length %d, %d bytes expected", len(data), crypter.KeySize)
+	}
+	return data, nil
+}
+
+func (m *Manager) findMember(name string) (int, *vaultMember) {
+	for i, member := range m.members {
+		if member.Name == name {
+			return i, member
+		}
+	}
+	return -1, nil
+}
+
+func (m *Manager) isSelf(member *vaultMember) bool {
+	return bytes.Equal(member.PublicKey, m.webdavAuthData.PublicKey)
+}
+
+func (m *Manager) doMember(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		term.Errorf("Use member add <name> <public key>, member remove <name> or member list\n")
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		m.memberAdd(args[1:]...)
+	case "remove", "rm", "del":
+		m.memberRemove(args[1:]...)
+	case "list", "ls":
+		m.memberList()
+	default:
+		term.Errorf("Unknown member subcommand: %s\n", args[0])
+	}
+}
+
+func (m *Manager) memberAdd(args ...string) {
+	if len(args) < 2 {
+		term.Errorf("Use member add <name> <public key>\n")
+		return
+	}
+
+	memberName := args[0]
+	if _, found := m.findMember(memberName); found != nil {
+		term.Errorf("Member %s already exists\n", memberName)
+		return
+	}
+
+	publicKey, err := decodeKey(args[1])
+	if err != nil {
+		term.Errorf("Error decoding public key: %s\n", err)
+		return
+	}
+
+	for _, member := range m.members {
+		if bytes.Equal(member.PublicKey, publicKey) {
+			term.Errorf("This public key already belongs to member %s\n", member.Name)
+			return
+		}
+	}
+
+	m.members = append(m.members, &vaultMember{Name: memberName, PublicKey: publicKey})
+	term.Successf("Member %s added. Don't forget to **save** the result.\n", memberName)
+}
+
+func (m *Manager) memberRemove(args ...string) {
+	if len(args) < 1 {
+		term.Errorf("Use member remove <name>\n")
+		return
+	}
+
+	memberName := args[0]
+	idx, member := m.findMember(memberName)
+	if member == nil {
+		term.Errorf("Member %s not found\n", memberName)
+		return
+	}
+
+	if m.isSelf(member) {
+		term.Errorf("You can't remove yourself from the vault\n")
+		return
+	}
+
+	err := m.rekeyAttachments()
+	if err != nil {
+		term.Errorf("Error re-encrypting attachments: %s\n", err)
+		return
+	}
+
+	dataKey, err := crypter.GenerateKey()
+	if err != nil {
+		term.Errorf("Error generating a new vault data key: %s\n", err)
+		return
+	}
+
+	err = m.rekeyEntries(dataKey)
+	secmem.Wipe(dataKey)
+	if err != nil {
+		term.Errorf("Error rekeying vault entries: %s\n", err)
+		return
+	}
+
+	m.members = append(m.members[:idx], m.members[idx+1:]...)
+	for _, other := range m.members {
+		// recovery keys hold the old data key, every member
+		// gets a new one on their next save
+		if !m.isSelf(other) {
+			other.Recovery = nil
+		}
+	}
+	m.keyGeneration++
+	term.Successf("Member %s removed and the vault rekeyed. Don't forget to **save** the result.\n", memberName)
+}
+
+func (m *Manager) memberList() {
+	fmt.Printf("Your public key: %s\n\n", encodeKey(m.webdavAuthData.PublicKey))
+	for _, member := range m.members {
+		if m.isSelf(member) {
+			fmt.Printf("%s %s %s\n", member.Name, encodeKey(member.PublicKey), term.Cyan("(you)"))
+		} else {
+			fmt.Printf("%s %s\n", member.Name, encodeKey(member.PublicKey))
+		}
+	}
+}
+
+func (m *Manager) memberCompleter() completeFunc {
+	return func(line []rune) (newLine [][]rune, length int) {
+		names := make([]string, len(m.members))
+		for i, member := range m.members {
+			names[i] = member.Name
+		}
+		return staticCompleter(names)(line)
+	}
+}
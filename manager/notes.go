@@ -0,0 +1,237 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/viert/yanpassword/secmem"
+	"github.com/viert/yanpassword/term"
+)
+
+// Entry types
+const (
+	entryLogin = "login"
+	entryNote  = "note"
+)
+
+const (
+	heredocPrefix     = "<<"
+	defaultTerminator = "EOF"
+	editorValue       = "!edit"
+	clearValue        = "!clear"
+	escapePrefix      = "\\"
+)
+
+func (si *ServiceInfo) isNote() bool {
+	return si.Type == entryNote
+}
+
+// getText reads a value which may span multiple lines: <<END reads the
+// following lines up to a line containing END only, !edit opens the current
+// value in $EDITOR. A leading backslash makes them literal values.
+func getText(prompt string, current string) (string, error) {
+	input, err := getString(prompt)
+	if err != nil {
+		return "", err
+	}
+	return expandText(input, current)
+}
+
+// isTextCommand checks if the input is expanded rather than taken as is
+func isTextCommand(input string) bool {
+	return input == editorValue || input == clearValue || strings.HasPrefix(input, heredocPrefix)
+}
+
+func expandText(input string, current string) (string, error) {
+	switch {
+	case strings.HasPrefix(input, escapePrefix) && isTextCommand(strings.TrimLeft(input, escapePrefix)):
+		// \<<END is the literal <<END, \\<<END is \<<END and so on
+		return input[len(escapePrefix):], nil
+	case input == editorValue:
+		return editText(current)
+	case strings.HasPrefix(input, heredocPrefix):
+		terminator := strings.TrimSpace(input[len(heredocPrefix):])
+		if terminator == "" {
+			terminator = defaultTerminator
+		}
+		return readHeredoc(terminator)
+	default:
+		return input, nil
+	}
+}
+
+// readHeredoc reads lines up to the terminator line, the text is kept as is
+func readHeredoc(terminator string) (string, error) {
+	lines := make([]string, 0)
+	for {
+		fmt.Print("> ")
+		line, err := stdin.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("input ended before the %s terminator", terminator)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == terminator {
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+func editorCommand() string {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	return editor
+}
+
+// privateTempDir creates a directory for temporary files with secrets,
+// a memory-backed tmpfs is preferred so that the data never hits the disk
+func privateTempDir() (string, error) {
+	for _, base := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if base == "" {
+			continue
+		}
+		if st, err := os.Stat(base); err == nil && st.IsDir() {
+			return ioutil.TempDir(base, "yanpassword")
+		}
+	}
+	term.Warnf("No tmpfs directory found, the temporary file is created in %s\n", os.TempDir())
+	return ioutil.TempDir("", "yanpassword")
+}
+
+// wipeFile overwrites the file contents with zeroes
+func wipeFile(filename string) {
+	st, err := os.Stat(filename)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(make([]byte, st.Size()))
+	f.Sync()
+}
+
+// editText opens the text in $EDITOR using a temporary file in a private
+// directory, the file is wiped and removed along with the directory afterwards
+func editText(text string) (string, error) {
+	editor := editorCommand()
+	if editor == "" {
+		return "", fmt.Errorf("neither VISUAL nor EDITOR environment variable is set")
+	}
+
+	dir, err := privateTempDir()
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "note.txt")
+	defer wipeFile(filename)
+
+	err = ioutil.WriteFile(filename, []byte(text), os.FileMode(0600))
+	if err != nil {
+		return "", err
+	}
+
+	// the editor may come with arguments like "code --wait"
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", filename)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("error running editor %s: %s", editor, err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	defer secmem.Wipe(data)
+	return strings.TrimRight(string(data), "\n"), nil
+}
+
+// printValue prints a labelled value, multi-line values are printed
+// below the label exactly as they are
+func printValue(label string, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Printf("%s: %s\n", label, value)
+		return
+	}
+	fmt.Printf("%s:\n%s", label, value)
+	if !strings.HasSuffix(value, "\n") {
+		fmt.Println()
+	}
+}
+
+func (m *Manager) doNote(name string, argsLine string, args ...string) {
+	ca, err := parseArgs(args, "inline")
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	if len(ca.positional) < 1 {
+		term.Errorf("Use %s <service> [--inline] to create or edit a secure note\n", name)
+		return
+	}
+
+	serviceName := ca.positional[0]
+	si, exists := m.lookup(serviceName)
+	if !exists {
+		si = &ServiceInfo{Name: serviceName, Type: entryNote}
+	} else if !si.isNote() {
+		term.Errorf("Service %s is not a secure note\n", serviceName)
+		return
+	}
+
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+		return
+	}
+
+	var text string
+	if ca.has("inline") || editorCommand() == "" {
+		fmt.Printf("Type the note, finish with a line containing %s only\n", defaultTerminator)
+		text, err = readHeredoc(defaultTerminator)
+	} else {
+		text, err = editText(secret.Note)
+	}
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+
+	if exists && text == secret.Note {
+		term.Warnf("Note %s is not changed\n", serviceName)
+		return
+	}
+
+	secret.Note = text
+	err = m.setSecret(si, secret)
+	if err != nil {
+		term.Errorf("Error encrypting service %s: %s\n", serviceName, err)
+		return
+	}
+	si.touch()
+
+	err = m.put(si)
+	if err != nil {
+		term.Errorf("Error adding service %s: %s\n", serviceName, err)
+		return
+	}
+
+	if exists {
+		term.Successf("Note %s updated. Don't forget to **save** the result.\n", serviceName)
+	} else {
+		term.Successf("Note %s created. Don't forget to **save** the result.\n", serviceName)
+	}
+}
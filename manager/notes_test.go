@@ -0,0 +1,25 @@
+package manager
+
+import "testing"
+
+func TestExpandTextEscape(t *testing.T) {
+	for input, expected := range map[string]string{
+		"plain":       "plain",
+		`\<<END`:      "<<END",
+		`\\<<END`:     `\<<END`,
+		`\!edit`:      "!edit",
+		`\!clear`:     "!clear",
+		`\plain`:      `\plain`,
+		`\!editor`:    `\!editor`,
+		"a <<b":       "a <<b",
+		"prefix!edit": "prefix!edit",
+	} {
+		value, err := expandText(input, "current")
+		if err != nil {
+			t.Fatalf("expandText(%q): %s", input, err)
+		}
+		if value != expected {
+			t.Errorf("expandText(%q) = %q, want %q", input, value, expected)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/viert/yanpassword/term"
+)
+
+var (
+	listOptions = []string{"--sort", "--older-than", "--tag", "--type", "--tree"}
+)
+
+// normalizeFolder turns a folder path like /work/aws/ into work/aws
+func normalizeFolder(folder string) string {
+	parts := make([]string, 0)
+	for _, part := range strings.Split(folder, "/") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// parseTags splits comma or space separated tags removing duplicates
+func parseTags(input string) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, tag := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func (si *ServiceInfo) inFolder(folder string) bool {
+	return si.Folder == folder || strings.HasPrefix(si.Folder, folder+"/")
+}
+
+func (si *ServiceInfo) hasTag(tag string) bool {
+	for _, t := range si.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) setFolder(si *ServiceInfo, args ...string) {
+	var input string
+	var err error
+	if len(args) > 0 {
+		input = args[0]
+	} else {
+		input, err = getString(fmt.Sprintf("Folder [%s]: ", si.Folder))
+		if err != nil {
+			return
+		}
+	}
+
+	si.Folder = normalizeFolder(input)
+	si.touch()
+	if si.Folder == "" {
+		term.Successf("Service %s moved to the top level. Don't forget to **save** the result.\n", si.Name)
+	} else {
+		term.Successf("Service %s moved to %s/. Don't forget to **save** the result.\n", si.Name, si.Folder)
+	}
+}
+
+func (m *Manager) setTags(si *ServiceInfo, args ...string) {
+	var input string
+	var err error
+	if len(args) > 0 {
+		input = strings.Join(args, ",")
+	} else {
+		input, err = getString(fmt.Sprintf("Tags (comma separated) [%s]: ", strings.Join(si.Tags, ",")))
+		if err != nil {
+			return
+		}
+	}
+
+	si.Tags = parseTags(input)
+	if len(si.Tags) == 0 {
+		si.Tags = nil
+	}
+	si.touch()
+	term.Successf("Tags of %s set. Don't forget to **save** the result.\n", si.Name)
+}
+
+// tags returns all the tags in use
+func (m *Manager) tags() []string {
+	seen := make(map[string]bool)
+	tags := make([]string, 0)
+	for _, si := range m.data {
+		for _, tag := range si.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// folders returns all the folders in use including intermediate ones
+func (m *Manager) folders() []string {
+	seen := make(map[string]bool)
+	folders := make([]string, 0)
+	for _, si := range m.data {
+		if si.Folder == "" {
+			continue
+		}
+		parts := strings.Split(si.Folder, "/")
+		for i := range parts {
+			folder := strings.Join(parts[:i+1], "/") + "/"
+			if !seen[folder] {
+				seen[folder] = true
+				folders = append(folders, folder)
+			}
+		}
+	}
+	return folders
+}
+
+// folderNode is a node of the tree view
+type folderNode struct {
+	children map[string]*folderNode
+	entries  []string
+}
+
+func newFolderNode() *folderNode {
+	return &folderNode{children: make(map[string]*folderNode), entries: make([]string, 0)}
+}
+
+func (fn *folderNode) print(indent string) {
+	names := make([]string, 0, len(fn.children))
+	for name := range fn.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("%s%s\n", indent, term.Blue(name+"/"))
+		fn.children[name].print(indent + "  ")
+	}
+
+	sort.Strings(fn.entries)
+	for _, entry := range fn.entries {
+		fmt.Printf("%s%s\n", indent, entry)
+	}
+}
+
+func printTree(items []*ServiceInfo) {
+	root := newFolderNode()
+	for _, si := range items {
+		node := root
+		if si.Folder != "" {
+			for _, part := range strings.Split(si.Folder, "/") {
+				child, found := node.children[part]
+				if !found {
+					child = newFolderNode()
+					node.children[part] = child
+				}
+				node = child
+			}
+		}
+		node.entries = append(node.entries, si.Name)
+	}
+	root.print("")
+}
+
+// listCompleter completes list options, tags after --tag, types after --type
+// and folders otherwise
+func (m *Manager) listCompleter() completeFunc {
+	return func(line []rune) (newLine [][]rune, length int) {
+		tokens := exprWhiteSpace.Split(string(line), -1)
+		prefix := tokens[len(tokens)-1]
+
+		var variants []string
+		if len(tokens) > 1 && tokens[len(tokens)-2] == "--tag" {
+			variants = m.tags()
+		} else if len(tokens) > 1 && tokens[len(tokens)-2] == "--type" {
+			variants = append([]string{}, entryTypes...)
+		} else if strings.HasPrefix(prefix, "-") {
+			variants = append([]string{}, listOptions...)
+		} else {
+			variants = m.folders()
+		}
+		return staticCompleter(variants)([]rune(prefix))
+	}
+}
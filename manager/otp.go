@@ -0,0 +1,163 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/viert/yanpassword/term"
+	"github.com/viert/yanpassword/totp"
+)
+
+// totpCode generates the current code of a key stored in a service secret
+func totpCode(uri string, now time.Time) (string, time.Duration, error) {
+	key, err := totp.Parse(uri)
+	if err != nil {
+		return "", 0, err
+	}
+	code, err := key.Code(now)
+	if err != nil {
+		return "", 0, err
+	}
+	return code, key.Remaining(now), nil
+}
+
+func (m *Manager) doTOTP(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		term.Errorf("%s command requires a service name\n", name)
+		return
+	}
+
+	serviceName := args[0]
+	si, found := m.lookup(serviceName)
+	if !found {
+		term.Errorf("Service %s not found\n", serviceName)
+		return
+	}
+
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+		return
+	}
+
+	if secret.TOTP == "" {
+		term.Errorf("Service %s has no TOTP secret, use set %s totp to add one\n", serviceName, serviceName)
+		return
+	}
+
+	code, remaining, err := totpCode(secret.TOTP, time.Now())
+	if err != nil {
+		term.Errorf("Error generating TOTP code: %s\n", err)
+		return
+	}
+	fmt.Printf("%s (%ds remaining)\n", code, remaining/time.Second)
+}
+
+// setTOTP prompts for a base32 secret or an otpauth:// URI, an empty value removes the secret
+func (m *Manager) setTOTP(si *ServiceInfo) {
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		term.Errorf("Error decrypting service %s: %s\n", si.Name, err)
+		return
+	}
+
+	var uri string
+	for {
+		input, err := m.rl.ReadPassword("TOTP secret or otpauth URI: ")
+		if err != nil {
+			return
+		}
+		if len(input) == 0 {
+			break
+		}
+		key, err := totp.Parse(string(input))
+		if err == nil {
+			uri = key.URI()
+			break
+		}
+		term.Errorf("Invalid TOTP secret: %s\n", err)
+	}
+
+	secret.TOTP = uri
+	err = m.setSecret(si, secret)
+	if err != nil {
+		term.Errorf("Error encrypting service %s: %s\n", si.Name, err)
+		return
+	}
+	si.touch()
+
+	if uri == "" {
+		term.Successf("TOTP secret removed. Don't forget to **save** the result.\n")
+	} else {
+		term.Successf("TOTP secret set. Don't forget to **save** the result.\n")
+	}
+}
+
+// isOTPList checks if the data to import is a list of otpauth:// URIs
+// rather than a json export
+func isOTPList(data []byte) bool {
+	return bytes.HasPrefix(bytes.ToLower(bytes.TrimSpace(data)), []byte("otpauth://"))
+}
+
+// importOTPList adds TOTP secrets from otpauth:// URIs, one per line, as exported
+// by authenticator apps. Secrets are attached to services named after the URI issuer
+// (or account if there's no issuer), missing services are created.
+func (m *Manager) importOTPList(data []byte) (added int, skipped int) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, err := totp.ParseURI(line)
+		if err != nil {
+			term.Warnf("Invalid otpauth URI, skipping: %s\n", err)
+			skipped++
+			continue
+		}
+
+		serviceName := key.Issuer
+		if serviceName == "" {
+			serviceName = key.Account
+		}
+		if serviceName == "" {
+			term.Warnf("otpauth URI has neither issuer nor account, skipping\n")
+			skipped++
+			continue
+		}
+
+		si, found := m.lookup(serviceName)
+		if !found {
+			si = &ServiceInfo{Name: serviceName, Username: key.Account}
+		}
+		secret, err := m.revealSecret(si)
+		if err != nil {
+			term.Errorf("Error decrypting service %s: %s\n", serviceName, err)
+			skipped++
+			continue
+		}
+		if secret.TOTP != "" {
+			term.Warnf("Service %s already has a TOTP secret, skipping\n", serviceName)
+			skipped++
+			continue
+		}
+
+		secret.TOTP = key.URI()
+		err = m.setSecret(si, secret)
+		if err == nil {
+			si.touch()
+			err = m.put(si)
+		}
+		if err != nil {
+			term.Errorf("Error importing service %s: %s\n", serviceName, err)
+			skipped++
+			continue
+		}
+		added++
+	}
+	return added, skipped
+}
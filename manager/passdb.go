@@ -6,6 +6,7 @@ import (
 
 	"github.com/viert/yanpassword/client"
 	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/secmem"
 	"github.com/viert/yanpassword/term"
 )
 
@@ -21,57 +22,235 @@ func (m *Manager) acquirePassdb() error {
 		if client.Is404(err) {
 			// data doesn't exist
 			fmt.Println("No remote data found, creating passdb from scratch")
-			m.data = m.createPassdb()
-			return nil
+			return m.createPassdb()
 		}
 		return err
 	}
 
-	// data exists
-	passwd := m.masterPassword
-	for {
-		decrypted, err = crypter.Decrypt(data, passwd)
-		if err == nil {
-			break
-		}
+	version := 0
+	if isVaultFile(data) {
+		decrypted, version, err = m.openVault(data)
+	} else {
+		decrypted, err = m.openLegacyPassdb(data)
+	}
+	if err != nil {
+		return err
+	}
 
-		term.Errorf("Error decrypting yanpasword data. Master password's changed?\n")
-		bytePwd, err := m.rl.ReadPassword("Previous Master Password: ")
-		if err != nil {
-			return err
+	defer secmem.Wipe(decrypted)
+
+	if version < 2 {
+		// passdb data predating per-entry encryption
+		m.data, err = m.sealPlainData(decrypted)
+	} else {
+		var idx *passdbIndex
+		idx, _, err = parseIndex(decrypted, version)
+		if err == nil {
+			if idx.Schema > schemaVersion {
+				warnNewerSchema(idx.Schema)
+			}
+			m.data = idx.Entries
+			m.trash = idx.Trash
+			m.policies = idx.Policies
+			m.schema = idx.Schema
+			m.meta = idx.Meta
+			m.indexExtra = idx.extra
+			m.orphanBlobs = idx.OrphanBlobs
 		}
-		passwd = string(bytePwd)
 	}
-
-	err = json.Unmarshal(decrypted, &m.data)
 	if err != nil {
 		term.Errorf("Error unmarshalling yanpassword data: %s\n", err)
 		return err
 	}
+	if m.data == nil {
+		m.data = make(serviceData)
+	}
+	if m.trash == nil {
+		m.trash = make(serviceData)
+	}
+	if m.meta == nil {
+		m.meta = &vaultMeta{CreatedAt: timestamp()}
+	}
+	if m.schema < schemaVersion {
+		m.schema = schemaVersion
+	}
+	m.reindex()
+	m.storedBlobs = m.referencedBlobs()
+	if purged := m.purgeTrash(); purged > 0 {
+		term.Warnf("%d entries purged from trash, they will be gone after **save**\n", purged)
+	}
 
 	term.Successf("Remote data loaded and parsed. %d items in total.\n", len(m.data))
-    r, err := m.data.dump()
-    fmt.Println(string(r))
 	return nil
 }
 
-func (m *Manager) createPassdb() serviceData {
-	return make(serviceData)
+func (m *Manager) openVault(data []byte) ([]byte, int, error) {
+	vf, err := parseVaultFile(data)
+	if err != nil {
+		term.Errorf("Error parsing yanpassword vault: %s\n", err)
+		return nil, 0, err
+	}
+
+	decrypted, dataKey, err := vf.open(m.webdavAuthData.PublicKey, m.privateKey.Bytes())
+	if err == errNotVaultMember && !m.config.DisablePasswordRecovery && vf.hasRecovery(m.webdavAuthData.Username) {
+		decrypted, dataKey, err = m.recoverVault(vf)
+	}
+	if err != nil {
+		term.Errorf("Error opening yanpassword vault: %s\n", err)
+		if err == errNotVaultMember {
+			fmt.Printf(`
+Ask one of the vault members to add you with the following command:
+
+  member add %s %s
+`+"\n", m.webdavAuthData.Username, encodeKey(m.webdavAuthData.PublicKey))
+		}
+		return nil, 0, err
+	}
+
+	m.dataKey, err = secmem.NewFrom(dataKey)
+	if err != nil {
+		secmem.Wipe(decrypted)
+		return nil, 0, err
+	}
+	m.members = vf.Members
+	m.keyGeneration = vf.Generation
+	m.vaultExtra = vf.extra
+	m.vaultID = vf.ID
+	m.revision = vf.Revision
+	if m.vaultID == "" {
+		// vaults predating authenticated context get an id on next save
+		m.vaultID, err = newVaultID()
+		if err != nil {
+			secmem.Wipe(decrypted)
+			return nil, 0, err
+		}
+	} else {
+		m.checkRevision(m.vaultID, m.revision)
+	}
+	return decrypted, vf.Version, nil
+}
+
+// openLegacyPassdb decrypts a single-password passdb. The passdb is converted
+// to a vault owned by the current user the next time it's saved.
+func (m *Manager) openLegacyPassdb(data []byte) ([]byte, error) {
+	var decrypted []byte
+	var err error
+
+	decrypted, err = m.decryptLegacy(data, m.masterPassword.Bytes(), "Yanpassword data")
+	for err != nil {
+		if err == errLegacyRefused {
+			return nil, err
+		}
+		term.Errorf("Error decrypting yanpasword data. Master password's changed?\n")
+		passwd, rerr := m.rl.ReadPassword("Previous Master Password: ")
+		if rerr != nil {
+			return nil, rerr
+		}
+		decrypted, err = m.decryptLegacy(data, passwd, "Yanpassword data")
+		secmem.Wipe(passwd)
+	}
+	m.legacyPassdb = true
+
+	err = m.initVaultKeys()
+	if err != nil {
+		return nil, err
+	}
+	term.Warnf("Legacy single-password passdb loaded, it will be converted to a vault on next **save**\n")
+	return decrypted, nil
+}
+
+func (m *Manager) createPassdb() error {
+	m.data = make(serviceData)
+	m.names = make(map[string]string)
+	m.trash = make(serviceData)
+	m.schema = schemaVersion
+	m.meta = &vaultMeta{CreatedAt: timestamp()}
+	return m.initVaultKeys()
+}
+
+// initVaultKeys creates a new data key with the current user as the only vault member
+func (m *Manager) initVaultKeys() error {
+	dataKey, err := crypter.GenerateKey()
+	if err != nil {
+		term.Errorf("Error generating vault data key: %s\n", err)
+		return err
+	}
+	m.dataKey, err = secmem.NewFrom(dataKey)
+	if err != nil {
+		return err
+	}
+	m.members = []*vaultMember{
+		{Name: m.webdavAuthData.Username, PublicKey: m.webdavAuthData.PublicKey},
+	}
+	m.vaultID, err = newVaultID()
+	return err
 }
 
 func (m *Manager) savePassdb() error {
-	data, err := json.Marshal(m.data)
+	// never save a revision lower than the one seen last time
+	// so that a rolled back vault can't shadow newer ones
+	revision := m.revision
+	if lastSeen := m.state.Revisions[m.vaultID]; lastSeen > revision {
+		revision = lastSeen
+	}
+	revision++
+
+	orphans, expired := m.collectBlobs(revision)
+	m.meta.SavedAt = timestamp()
+	m.meta.SavedBy = m.webdavAuthData.Username
+	idx := &passdbIndex{
+		Schema:      m.schema,
+		Meta:        m.meta,
+		Entries:     m.data,
+		Trash:       m.trash,
+		Policies:    m.policies,
+		OrphanBlobs: orphans,
+		extra:       m.indexExtra,
+	}
+	data, err := json.Marshal(idx)
 	if err != nil {
 		term.Errorf("Error marshalling yanpassword data: %s\n", err)
 		return err
 	}
 
-	encrypted, err := crypter.Encrypt(data, m.masterPassword)
+	vf := &vaultFile{
+		ID:         m.vaultID,
+		Revision:   revision,
+		Generation: m.keyGeneration,
+		Members:    m.members,
+		extra:      m.vaultExtra,
+	}
+	err = m.updateRecovery(vf)
+	if err == nil {
+		err = vf.seal(data, m.dataKey.Bytes())
+	}
 	if err != nil {
 		term.Errorf("Error encrypting yanpassword data: %s\n", err)
 		return err
 	}
 
+	encrypted, err := vf.dump()
+	if err != nil {
+		term.Errorf("Error marshalling yanpassword vault: %s\n", err)
+		return err
+	}
+
 	cli := client.NewPassdbClient(m.webdavAuthData.Username, m.webdavAuthData.Password)
-	return cli.Save(encrypted)
+	err = m.uploadPendingBlobs(cli)
+	if err != nil {
+		term.Errorf("Error uploading attachments: %s\n", err)
+		return err
+	}
+
+	err = cli.Save(encrypted)
+	if err == nil {
+		m.legacyPassdb = false
+		m.revision = revision
+		m.recordRevision(m.vaultID, m.revision)
+		m.storedBlobs = m.referencedBlobs()
+		m.orphanBlobs = orphans
+		deleteBlobs(cli, expired)
+		m.bindAuthVault()
+	}
+	return err
 }
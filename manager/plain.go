@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"encoding/json"
+)
+
+// plainServiceInfo is the unencrypted representation of a service
+// used by import/export and by passdb files predating per-entry encryption
+type plainServiceInfo struct {
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name"`
+	Type      string           `json:"type,omitempty"`
+	Username  string           `json:"username"`
+	Password  string           `json:"password"`
+	Comment   string           `json:"comment"`
+	CreatedAt string           `json:"created_at"`
+	UpdatedAt string           `json:"updated_at"`
+	URL       string           `json:"url"`
+	Folder    string           `json:"folder,omitempty"`
+	Tags      []string         `json:"tags,omitempty"`
+	History   []passwordRecord `json:"history,omitempty"`
+	// Fields are custom fields with secret values in the clear
+	Fields map[string]*customField `json:"fields,omitempty"`
+	// TOTP is an otpauth:// URI or a base32 secret
+	TOTP string `json:"totp,omitempty"`
+	Note string `json:"note,omitempty"`
+	// PasswordChangedAt, RotateEvery and ExpiresAt are rotation settings
+	PasswordChangedAt string `json:"password_changed_at,omitempty"`
+	RotateEvery       string `json:"rotate_every,omitempty"`
+	ExpiresAt         string `json:"expires_at,omitempty"`
+}
+
+type plainServiceData map[string]*plainServiceInfo
+
+func (p *plainServiceInfo) info() *ServiceInfo {
+	si := &ServiceInfo{
+		ID:        p.ID,
+		Name:      p.Name,
+		Type:      p.Type,
+		Username:  p.Username,
+		Comment:   p.Comment,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+		URL:       p.URL,
+		Folder:    normalizeFolder(p.Folder),
+		Tags:      p.Tags,
+
+		PasswordChangedAt: p.PasswordChangedAt,
+		RotateEvery:       p.RotateEvery,
+		ExpiresAt:         p.ExpiresAt,
+	}
+	if len(p.Fields) > 0 {
+		si.Fields = make(map[string]*customField)
+		for name, field := range p.Fields {
+			if field.isSecret() {
+				si.Fields[name] = &customField{Type: field.Type}
+			} else {
+				si.Fields[name] = &customField{Type: field.Type, Value: field.Value}
+			}
+		}
+	}
+	return si
+}
+
+func (p *plainServiceInfo) secret() *serviceSecret {
+	secret := &serviceSecret{Password: p.Password, History: p.History, TOTP: p.TOTP, Note: p.Note}
+	for name, field := range p.Fields {
+		if field.isSecret() {
+			if secret.Fields == nil {
+				secret.Fields = make(map[string]string)
+			}
+			secret.Fields[name] = field.Value
+		}
+	}
+	return secret
+}
+
+func plainFields(si *ServiceInfo, secret *serviceSecret) map[string]*customField {
+	if len(si.Fields) == 0 {
+		return nil
+	}
+	fields := make(map[string]*customField)
+	for name, field := range si.Fields {
+		value := field.Value
+		if field.isSecret() {
+			value = secret.Fields[name]
+		}
+		fields[name] = &customField{Type: field.Type, Value: value}
+	}
+	return fields
+}
+
+func (m *Manager) sealPlainData(data []byte) (serviceData, error) {
+	pd := make(plainServiceData)
+	err := json.Unmarshal(data, &pd)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := make(serviceData)
+	for k, v := range pd {
+		si := v.info()
+		if si.Name == "" {
+			si.Name = k
+		}
+		err = m.setSecret(si, v.secret())
+		if err != nil {
+			return nil, err
+		}
+		sd[k] = si
+	}
+	return indexByID(sd)
+}
+
+func (m *Manager) plainData() (plainServiceData, error) {
+	pd := make(plainServiceData)
+	for _, si := range m.data {
+		secret, err := m.revealSecret(si)
+		if err != nil {
+			return nil, err
+		}
+		pd[si.Name] = &plainServiceInfo{
+			ID:        si.ID,
+			Name:      si.Name,
+			Type:      si.Type,
+			Username:  si.Username,
+			Password:  secret.Password,
+			Comment:   si.Comment,
+			CreatedAt: si.CreatedAt,
+			UpdatedAt: si.UpdatedAt,
+			URL:       si.URL,
+			Folder:    si.Folder,
+			Tags:      si.Tags,
+			History:   secret.History,
+			Fields:    plainFields(si, secret),
+			TOTP:      secret.TOTP,
+			Note:      secret.Note,
+
+			PasswordChangedAt: si.PasswordChangedAt,
+			RotateEvery:       si.RotateEvery,
+			ExpiresAt:         si.ExpiresAt,
+		}
+	}
+	return pd, nil
+}
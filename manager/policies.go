@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/viert/yanpassword/passgen"
+	"github.com/viert/yanpassword/term"
+)
+
+var (
+	policySubcommands = []string{"list", "rotate", "gen"}
+)
+
+// tagPolicy is a set of rules applied to all the entries having the tag,
+// tag policies are kept in the vault so they're shared by all the members
+type tagPolicy struct {
+	RotateEvery string          `json:"rotate_every,omitempty"`
+	Generate    *passgen.Policy `json:"generate,omitempty"`
+	extra       unknownFields
+	// generateExtra are the fields of Generate unknown to this version
+	generateExtra unknownFields
+}
+
+func (p *tagPolicy) empty() bool {
+	return p.RotateEvery == "" && p.Generate == nil
+}
+
+// policy returns the policy of the tag creating it if it doesn't exist
+func (m *Manager) policy(tag string) *tagPolicy {
+	if m.policies == nil {
+		m.policies = make(map[string]*tagPolicy)
+	}
+	p, found := m.policies[tag]
+	if !found {
+		p = new(tagPolicy)
+		m.policies[tag] = p
+	}
+	return p
+}
+
+// cleanupPolicy removes the tag policy if it has no rules left
+func (m *Manager) cleanupPolicy(tag string) {
+	if p, found := m.policies[tag]; found && p.empty() {
+		delete(m.policies, tag)
+	}
+}
+
+func (m *Manager) doPolicy(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		term.Errorf("Use policy list, policy rotate <tag> <interval|off> or policy gen <tag> <options|off>\n")
+		return
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		m.policyList()
+	case "rotate":
+		m.policyRotate(args[1:]...)
+	case "gen":
+		m.policyGen(args[1:]...)
+	default:
+		term.Errorf("Unknown policy subcommand: %s\n", args[0])
+	}
+}
+
+func (m *Manager) policyList() {
+	if len(m.policies) == 0 {
+		term.Warnf("No tag policies set\n")
+		return
+	}
+
+	tags := make([]string, 0, len(m.policies))
+	for tag := range m.policies {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	for _, tag := range tags {
+		p := m.policies[tag]
+		fmt.Printf("%s\n", term.Blue(tag))
+		if p.RotateEvery != "" {
+			fmt.Printf("  rotate every %s\n", p.RotateEvery)
+		}
+		if p.Generate != nil {
+			fmt.Printf("  generate %s\n", p.Generate)
+		}
+	}
+}
+
+func (m *Manager) policyRotate(args ...string) {
+	if len(args) < 2 {
+		term.Errorf("Use policy rotate <tag> <interval|off>, e.g. policy rotate prod 90d\n")
+		return
+	}
+
+	tag, interval := args[0], args[1]
+	if interval == rotationOff {
+		m.policy(tag).RotateEvery = ""
+		m.cleanupPolicy(tag)
+		term.Successf("Rotation policy of tag %s removed. Don't forget to **save** the result.\n", tag)
+		return
+	}
+
+	_, err := parseAge(interval)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	m.policy(tag).RotateEvery = interval
+	term.Successf("Services tagged %s are to be rotated every %s. Don't forget to **save** the result.\n", tag, interval)
+}
+
+// tagCompleter completes tags in use
+func (m *Manager) tagCompleter() completeFunc {
+	return func(line []rune) (newLine [][]rune, length int) {
+		return staticCompleter(m.tags())(line)
+	}
+}
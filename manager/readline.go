@@ -75,6 +75,22 @@ func completeFiles(line []rune) (newLine [][]rune, length int) {
 	return results, ll
 }
 
+// subcommandCompleter completes a subcommand name and then
+// delegates the rest of the line to the subcommand's completer if any
+func subcommandCompleter(subcommands []string, completers map[string]completeFunc) completeFunc {
+	sc := staticCompleter(subcommands)
+	return func(line []rune) (newLine [][]rune, length int) {
+		sub, args := wsSplit(line)
+		if args == nil {
+			return sc(sub)
+		}
+		if handler, found := completers[string(sub)]; found {
+			return handler(args)
+		}
+		return [][]rune{}, 0
+	}
+}
+
 func newCliCompleter(commands []string) *cliCompleter {
 	c := &cliCompleter{commands, make(map[string]completeFunc)}
 	c.completers["import"] = completeFiles
@@ -116,16 +132,19 @@ func (c *cliCompleter) completeCommand(line []rune) (newLine [][]rune, length in
 	return toRunes(sr), len(line)
 }
 
+// nameCompleter completes the last argument with service names
 func (m *Manager) nameCompleter() completeFunc {
 	return func(line []rune) (newLine [][]rune, length int) {
+		tokens := exprWhiteSpace.Split(string(line), -1)
+		prefix := tokens[len(tokens)-1]
 		sr := make([]string, 0)
-		for name := range m.data {
-			if strings.HasPrefix(name, string(line)) {
-				sr = append(sr, name[len(line):])
+		for name := range m.names {
+			if strings.HasPrefix(name, prefix) {
+				sr = append(sr, name[len(prefix):])
 			}
 		}
 		sort.Strings(sr)
-		return toRunes(sr), len(line)
+		return toRunes(sr), len([]rune(prefix))
 	}
 }
 
@@ -143,12 +162,35 @@ func (m *Manager) setupReadline() error {
 	nc := m.nameCompleter()
 	cc.completers["get"] = nc
 	cc.completers["getpass"] = nc
+	cc.completers["copy"] = m.argsCompleter(argService, argField)
 	cc.completers["set"] = nc
 	cc.completers["setpass"] = nc
 	cc.completers["delete"] = nc
 	cc.completers["remove"] = nc
 	cc.completers["rm"] = nc
 	cc.completers["del"] = nc
+	cc.completers["list"] = m.listCompleter()
+	cc.completers["ls"] = cc.completers["list"]
+	cc.completers["undelete"] = m.trashCompleter()
+	cc.completers["rename"] = nc
+	cc.completers["mv"] = nc
+	cc.completers["cp"] = nc
+	cc.completers["note"] = nc
+	cc.completers["attach"] = m.argsCompleter(argService, argFile)
+	cc.completers["attachments"] = nc
+	cc.completers["extract"] = m.argsCompleter(argService, argAttachment, argFile)
+	cc.completers["detach"] = m.argsCompleter(argService, argAttachment)
+	cc.completers["totp"] = nc
+	cc.completers["history"] = nc
+	cc.completers["revert"] = nc
+	cc.completers["policy"] = subcommandCompleter(
+		policySubcommands,
+		map[string]completeFunc{"rotate": m.tagCompleter(), "gen": m.tagCompleter()},
+	)
+	cc.completers["member"] = subcommandCompleter(
+		memberSubcommands,
+		map[string]completeFunc{"remove": m.memberCompleter()},
+	)
 
 	readlineConfig := &readline.Config{
 		InterruptPrompt:   "^C",
@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"github.com/viert/yanpassword/secmem"
+	"github.com/viert/yanpassword/term"
+)
+
+// updateRecovery seals the data key with the master key for the current
+// user, or drops the user's recovery key if password recovery is disabled
+func (m *Manager) updateRecovery(vf *vaultFile) error {
+	for _, member := range vf.Members {
+		if !m.isSelf(member) {
+			continue
+		}
+		if m.config.DisablePasswordRecovery {
+			member.Recovery = nil
+			continue
+		}
+		err := vf.sealRecovery(member, m.dataKey.Bytes(), m.masterKey.Bytes(), m.masterSalt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverVault opens the vault with the recovery key of the member named after
+// the Yandex user when the current key pair isn't a member, i.e. when the auth
+// data has been created anew. The member gets the current public key on next save.
+func (m *Manager) recoverVault(vf *vaultFile) ([]byte, []byte, error) {
+	member, data, dataKey, err := vf.recover(m.webdavAuthData.Username, m.masterPassword.Bytes())
+	for err != nil {
+		term.Errorf("Your key pair is not a vault member and the master password doesn't open your recovery key. Master password's changed?\n")
+		passwd, rerr := m.rl.ReadPassword("Previous Master Password (empty to give up): ")
+		if rerr != nil || len(passwd) == 0 {
+			return nil, nil, errNotVaultMember
+		}
+		member, data, dataKey, err = vf.recover(m.webdavAuthData.Username, passwd)
+		secmem.Wipe(passwd)
+	}
+
+	term.Warnf("Vault opened with your recovery key, your new public key replaces the old one on next **save**\n")
+	member.PublicKey = m.webdavAuthData.PublicKey
+	return data, dataKey, nil
+}
@@ -0,0 +1,245 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/viert/yanpassword/term"
+)
+
+const (
+	rotationOff           = "off"
+	defaultExpiringWithin = "30d"
+	maxOverdueReported    = 10
+)
+
+// setPassword changes the service password keeping track of the time it's changed at
+func (si *ServiceInfo) setPassword(secret *serviceSecret, pwd string) {
+	if secret.setPassword(pwd) {
+		si.PasswordChangedAt = timestamp()
+	}
+}
+
+// passwordTime returns the time the password was changed at. False is returned
+// for entries created before the time was tracked, their modification time
+// may be the time of an unrelated edit so it says nothing about the password.
+func (si *ServiceInfo) passwordTime() (time.Time, bool) {
+	return parseTimestamp(si.PasswordChangedAt)
+}
+
+// rotationInterval returns the rotation interval set for the entry itself
+// or the shortest one set by the policies of its tags
+func (m *Manager) rotationInterval(si *ServiceInfo) (time.Duration, bool) {
+	if si.RotateEvery != "" {
+		interval, err := parseAge(si.RotateEvery)
+		return interval, err == nil
+	}
+
+	var shortest time.Duration
+	found := false
+	for _, tag := range si.Tags {
+		p, exists := m.policies[tag]
+		if !exists || p.RotateEvery == "" {
+			continue
+		}
+		interval, err := parseAge(p.RotateEvery)
+		if err != nil {
+			continue
+		}
+		if !found || interval < shortest {
+			shortest = interval
+			found = true
+		}
+	}
+	return shortest, found
+}
+
+// dueTime returns the time the entry is due to rotate, either by its
+// rotation interval or by its expiry date whichever comes first. The rotation
+// interval is ignored if the time the password was changed at is unknown.
+func (m *Manager) dueTime(si *ServiceInfo) (time.Time, bool) {
+	var due time.Time
+	found := false
+
+	if interval, ok := m.rotationInterval(si); ok {
+		if changed, known := si.passwordTime(); known {
+			due = changed.Add(interval)
+			found = true
+		}
+	}
+	if si.ExpiresAt != "" {
+		expires, err := time.ParseInLocation(fieldDateFormat, si.ExpiresAt, time.Local)
+		if err == nil && (!found || expires.Before(due)) {
+			due = expires
+			found = true
+		}
+	}
+	return due, found
+}
+
+type dueEntry struct {
+	si  *ServiceInfo
+	due time.Time
+}
+
+// dueEntries returns the entries due to rotate before the deadline, the earliest first
+func (m *Manager) dueEntries(deadline time.Time) []*dueEntry {
+	entries := make([]*dueEntry, 0)
+	for _, si := range m.data {
+		due, ok := m.dueTime(si)
+		if ok && due.Before(deadline) {
+			entries = append(entries, &dueEntry{si, due})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].due.Equal(entries[j].due) {
+			return entries[i].si.Name < entries[j].si.Name
+		}
+		return entries[i].due.Before(entries[j].due)
+	})
+	return entries
+}
+
+// unknownRotation returns the names of the entries having a rotation interval
+// but no time the password was changed at to count it from
+func (m *Manager) unknownRotation() []string {
+	names := make([]string, 0)
+	for _, si := range m.data {
+		if _, ok := m.rotationInterval(si); !ok {
+			continue
+		}
+		if _, known := si.passwordTime(); !known {
+			names = append(names, si.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatDue(due time.Time, now time.Time) string {
+	days := int(due.Sub(now).Hours() / 24)
+	switch {
+	case due.Before(now) && days == 0:
+		return term.Red("overdue")
+	case due.Before(now):
+		return term.Red(fmt.Sprintf("overdue by %dd", -days))
+	case days == 0:
+		return "due today"
+	default:
+		return fmt.Sprintf("due in %dd", days)
+	}
+}
+
+// reportOverdue warns about entries due to rotate, it's called once the passdb is loaded
+func (m *Manager) reportOverdue() {
+	now := time.Now()
+	overdue := m.dueEntries(now)
+	if unknown := m.unknownRotation(); len(unknown) > 0 {
+		term.Warnf("%d services have a rotation interval but no password change time, use expiring to list them\n", len(unknown))
+	}
+	if len(overdue) == 0 {
+		return
+	}
+
+	term.Warnf("Services overdue for password rotation (%d):\n", len(overdue))
+	for i, de := range overdue {
+		if i == maxOverdueReported {
+			fmt.Printf("  ...and %d more, use expiring to list them all\n", len(overdue)-maxOverdueReported)
+			break
+		}
+		fmt.Printf("  %s  %s\n", de.si.Name, formatDue(de.due, now))
+	}
+}
+
+func (m *Manager) doExpiring(name string, argsLine string, args ...string) {
+	ca, err := parseArgs(args, "within=")
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+
+	within := defaultExpiringWithin
+	if ca.has("within") {
+		within = ca.get("within")
+	}
+	period, err := parseAge(within)
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+
+	now := time.Now()
+	entries := m.dueEntries(now.Add(period))
+	unknown := m.unknownRotation()
+	if len(entries) == 0 && len(unknown) == 0 {
+		term.Successf("No services are due to rotate within %s\n", within)
+		return
+	}
+
+	width := 0
+	for _, de := range entries {
+		if len(de.si.Name) > width {
+			width = len(de.si.Name)
+		}
+	}
+	for _, name := range unknown {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	for _, de := range entries {
+		fmt.Printf("%-*s  %s  %s\n", width, de.si.Name, de.due.Local().Format(fieldDateFormat), formatDue(de.due, now))
+	}
+	for _, name := range unknown {
+		fmt.Printf("%-*s  %-*s  %s\n", width, name, len(fieldDateFormat), "unknown", term.Yellow("password change time unknown, change the password to start counting"))
+	}
+}
+
+// setRotation sets the entry rotation interval, off removes it
+func (m *Manager) setRotation(si *ServiceInfo, args ...string) {
+	if len(args) < 1 {
+		term.Errorf("Use set <service> rotate <interval|off>, e.g. set %s rotate 90d\n", si.Name)
+		return
+	}
+
+	if args[0] == rotationOff {
+		si.RotateEvery = ""
+		si.touch()
+		term.Successf("Rotation interval of %s removed. Don't forget to **save** the result.\n", si.Name)
+		return
+	}
+
+	_, err := parseAge(args[0])
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	si.RotateEvery = args[0]
+	si.touch()
+	term.Successf("Service %s is to be rotated every %s. Don't forget to **save** the result.\n", si.Name, si.RotateEvery)
+}
+
+// setExpiry sets the entry expiry date, off removes it
+func (m *Manager) setExpiry(si *ServiceInfo, args ...string) {
+	if len(args) < 1 {
+		term.Errorf("Use set <service> expires <YYYY-MM-DD|off>\n")
+		return
+	}
+
+	if args[0] == rotationOff {
+		si.ExpiresAt = ""
+		si.touch()
+		term.Successf("Expiry date of %s removed. Don't forget to **save** the result.\n", si.Name)
+		return
+	}
+
+	err := validateField(fieldDate, args[0])
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	si.ExpiresAt = args[0]
+	si.touch()
+	term.Successf("Service %s expires on %s. Don't forget to **save** the result.\n", si.Name, si.ExpiresAt)
+}
@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDueTimeUnknownPasswordTime(t *testing.T) {
+	m := &Manager{config: defaultConfig(), data: make(serviceData)}
+	si := &ServiceInfo{Name: "legacy", RotateEvery: "90d"}
+	si.ID, _ = newEntryID()
+	m.data[si.ID] = si
+
+	// the modification time may be of an edit unrelated to the password
+	si.touch()
+	if _, known := si.passwordTime(); known {
+		t.Error("password time of an entry without the password change time is known")
+	}
+	if due, ok := m.dueTime(si); ok {
+		t.Errorf("entry without the password change time is due at %s", due)
+	}
+	if unknown := m.unknownRotation(); len(unknown) != 1 || unknown[0] != "legacy" {
+		t.Errorf("unknownRotation() = %v, want [legacy]", unknown)
+	}
+
+	si.setPassword(new(serviceSecret), "new password")
+	if _, ok := m.dueTime(si); !ok {
+		t.Error("entry with the password change time has no due time")
+	}
+	if unknown := m.unknownRotation(); len(unknown) != 0 {
+		t.Errorf("unknownRotation() = %v, want none", unknown)
+	}
+}
+
+func TestFormatDue(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		due      time.Time
+		expected string
+	}{
+		{now.Add(-3 * time.Hour), "overdue"},
+		{now.Add(-50 * time.Hour), "overdue by 2d"},
+		{now.Add(3 * time.Hour), "due today"},
+		{now.Add(50 * time.Hour), "due in 2d"},
+	} {
+		// overdue values are colored
+		if got := formatDue(tc.due, now); !strings.Contains(got, tc.expected) || strings.Contains(got, "by 0d") {
+			t.Errorf("formatDue(now%+v) = %q, want %q", tc.due.Sub(now), got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/viert/yanpassword/secmem"
+	"github.com/viert/yanpassword/term"
+)
+
+const (
+	// schema 0 payload entries are keyed by names (vault versions 2 and 3),
+	// schema 1 payload entries are keyed by ids (vault version 4),
+	// schema 2 payload has the schema version and the vault metadata
+	schemaVersion = 2
+)
+
+// migration upgrades a decrypted payload document by one schema version
+type migration func(doc map[string]json.RawMessage) error
+
+// migrations are indexed by the schema version they upgrade from
+var migrations = []migration{
+	migrateEntriesByID,
+	migrateVaultMeta,
+}
+
+// vaultMeta is the vault metadata kept in the encrypted payload
+type vaultMeta struct {
+	CreatedAt string `json:"created_at,omitempty"`
+	SavedAt   string `json:"saved_at,omitempty"`
+	SavedBy   string `json:"saved_by,omitempty"`
+	extra     unknownFields
+}
+
+// unknownFields are json object fields unknown to this version of yanpassword,
+// they are kept so that data written by newer versions survives re-saving
+type unknownFields map[string]json.RawMessage
+
+// jsonFieldNames returns json names of the struct fields
+func jsonFieldNames(t reflect.Type) []string {
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// unexported field
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// unmarshalKeepUnknown unmarshals data into v, which must be a pointer to
+// a struct with no custom unmarshaller, returning the unknown fields
+func unmarshalKeepUnknown(data []byte, v interface{}) (unknownFields, error) {
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(unknownFields)
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range jsonFieldNames(reflect.TypeOf(v).Elem()) {
+		// known values may be secrets
+		secmem.Wipe(fields[name])
+		delete(fields, name)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// marshalWithUnknown marshals v adding the unknown fields back
+func marshalWithUnknown(v interface{}, extra unknownFields) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	defer secmem.Wipe(data)
+	fields := make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range fields {
+		// known values may be secrets
+		defer secmem.Wipe(value)
+	}
+	for name, value := range extra {
+		if _, found := fields[name]; !found {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON keeps fields unknown to this version
+func (idx *passdbIndex) UnmarshalJSON(data []byte) error {
+	type plain passdbIndex
+	extra, err := unmarshalKeepUnknown(data, (*plain)(idx))
+	idx.extra = extra
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (idx *passdbIndex) MarshalJSON() ([]byte, error) {
+	type plain passdbIndex
+	return marshalWithUnknown((*plain)(idx), idx.extra)
+}
+
+// UnmarshalJSON keeps fields unknown to this version
+func (meta *vaultMeta) UnmarshalJSON(data []byte) error {
+	type plain vaultMeta
+	extra, err := unmarshalKeepUnknown(data, (*plain)(meta))
+	meta.extra = extra
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (meta *vaultMeta) MarshalJSON() ([]byte, error) {
+	type plain vaultMeta
+	return marshalWithUnknown((*plain)(meta), meta.extra)
+}
+
+// UnmarshalJSON keeps fields unknown to this version
+func (si *ServiceInfo) UnmarshalJSON(data []byte) error {
+	type plain ServiceInfo
+	extra, err := unmarshalKeepUnknown(data, (*plain)(si))
+	si.extra = extra
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (si *ServiceInfo) MarshalJSON() ([]byte, error) {
+	type plain ServiceInfo
+	return marshalWithUnknown((*plain)(si), si.extra)
+}
+
+// UnmarshalJSON keeps fields unknown to this version
+func (s *serviceSecret) UnmarshalJSON(data []byte) error {
+	type plain serviceSecret
+	extra, err := unmarshalKeepUnknown(data, (*plain)(s))
+	s.extra = extra
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (s *serviceSecret) MarshalJSON() ([]byte, error) {
+	type plain serviceSecret
+	return marshalWithUnknown((*plain)(s), s.extra)
+}
+
+// UnmarshalJSON keeps fields unknown to this version
+func (f *customField) UnmarshalJSON(data []byte) error {
+	type plain customField
+	extra, err := unmarshalKeepUnknown(data, (*plain)(f))
+	f.extra = extra
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (f *customField) MarshalJSON() ([]byte, error) {
+	type plain customField
+	return marshalWithUnknown((*plain)(f), f.extra)
+}
+
+// UnmarshalJSON keeps fields unknown to this version
+func (att *attachment) UnmarshalJSON(data []byte) error {
+	type plain attachment
+	extra, err := unmarshalKeepUnknown(data, (*plain)(att))
+	att.extra = extra
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (att *attachment) MarshalJSON() ([]byte, error) {
+	type plain attachment
+	return marshalWithUnknown((*plain)(att), att.extra)
+}
+
+// UnmarshalJSON keeps fields unknown to this version including
+// the ones of the generator policy defined in the passgen package
+func (p *tagPolicy) UnmarshalJSON(data []byte) error {
+	type plain tagPolicy
+	extra, err := unmarshalKeepUnknown(data, (*plain)(p))
+	if err != nil {
+		return err
+	}
+	p.extra = extra
+	p.generateExtra = nil
+	if p.Generate == nil {
+		return nil
+	}
+
+	var raw struct {
+		Generate json.RawMessage `json:"generate"`
+	}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	p.generateExtra, err = unmarshalKeepUnknown(raw.Generate, p.Generate)
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (p *tagPolicy) MarshalJSON() ([]byte, error) {
+	type plain tagPolicy
+	// the outer Generate shadows the one of the embedded policy
+	v := struct {
+		*plain
+		Generate json.RawMessage `json:"generate,omitempty"`
+	}{plain: (*plain)(p)}
+	if p.Generate != nil {
+		var err error
+		v.Generate, err = marshalWithUnknown(p.Generate, p.generateExtra)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return marshalWithUnknown(&v, p.extra)
+}
+
+// UnmarshalJSON keeps fields unknown to this version
+func (rec *passwordRecord) UnmarshalJSON(data []byte) error {
+	type plain passwordRecord
+	extra, err := unmarshalKeepUnknown(data, (*plain)(rec))
+	rec.extra = extra
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (rec *passwordRecord) MarshalJSON() ([]byte, error) {
+	type plain passwordRecord
+	return marshalWithUnknown((*plain)(rec), rec.extra)
+}
+
+// UnmarshalJSON keeps fields unknown to this version
+func (member *vaultMember) UnmarshalJSON(data []byte) error {
+	type plain vaultMember
+	extra, err := unmarshalKeepUnknown(data, (*plain)(member))
+	member.extra = extra
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (member *vaultMember) MarshalJSON() ([]byte, error) {
+	type plain vaultMember
+	return marshalWithUnknown((*plain)(member), member.extra)
+}
+
+// UnmarshalJSON keeps fields unknown to this version
+func (ss *sealedSecret) UnmarshalJSON(data []byte) error {
+	type plain sealedSecret
+	extra, err := unmarshalKeepUnknown(data, (*plain)(ss))
+	ss.extra = extra
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (ss *sealedSecret) MarshalJSON() ([]byte, error) {
+	type plain sealedSecret
+	return marshalWithUnknown((*plain)(ss), ss.extra)
+}
+
+// UnmarshalJSON keeps fields unknown to this version
+func (vf *vaultFile) UnmarshalJSON(data []byte) error {
+	type plain vaultFile
+	extra, err := unmarshalKeepUnknown(data, (*plain)(vf))
+	vf.extra = extra
+	return err
+}
+
+// MarshalJSON adds back fields unknown to this version
+func (vf *vaultFile) MarshalJSON() ([]byte, error) {
+	type plain vaultFile
+	return marshalWithUnknown((*plain)(vf), vf.extra)
+}
+
+// parseIndex parses the decrypted payload of a vault applying migrations
+// if the payload schema is older than the current one. The original
+// payload schema version is returned along with the index.
+func parseIndex(data []byte, vaultVersion int) (*passdbIndex, int, error) {
+	doc := make(map[string]json.RawMessage)
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	schema := 0
+	if raw, found := doc["schema"]; found {
+		err = json.Unmarshal(raw, &schema)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid schema version: %s", err)
+		}
+	} else if vaultVersion >= 4 {
+		schema = 1
+	}
+
+	for v := schema; v < schemaVersion; v++ {
+		err = migrations[v](doc)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error migrating vault data from schema %d to %d: %s", v, v+1, err)
+		}
+	}
+
+	if schema < schemaVersion {
+		doc["schema"], _ = json.Marshal(schemaVersion)
+		data, err = json.Marshal(doc)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	idx := new(passdbIndex)
+	err = json.Unmarshal(data, idx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if idx.Meta == nil {
+		idx.Meta = new(vaultMeta)
+	}
+	return idx, schema, nil
+}
+
+func warnNewerSchema(schema int) {
+	term.Warnf(
+		"Vault data schema %d is newer than schema %d supported by this version of yanpassword, "+
+			"consider upgrading. Data unknown to this version is kept intact on save.\n",
+		schema,
+		schemaVersion,
+	)
+}
+
+// migrateEntriesByID re-keys entries by their ids generating
+// ids for entries created before ids were introduced
+func migrateEntriesByID(doc map[string]json.RawMessage) error {
+	raw, found := doc["entries"]
+	if !found {
+		return nil
+	}
+
+	entries := make(map[string]map[string]json.RawMessage)
+	err := json.Unmarshal(raw, &entries)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]map[string]json.RawMessage)
+	for _, entry := range entries {
+		var id string
+		if rawID, found := entry["id"]; found {
+			json.Unmarshal(rawID, &id)
+		}
+		if id == "" {
+			id, err = newEntryID()
+			if err != nil {
+				return err
+			}
+			entry["id"], _ = json.Marshal(id)
+		}
+		byID[id] = entry
+	}
+
+	doc["entries"], err = json.Marshal(byID)
+	return err
+}
+
+// migrateVaultMeta adds the vault metadata
+func migrateVaultMeta(doc map[string]json.RawMessage) error {
+	if _, found := doc["meta"]; found {
+		return nil
+	}
+	var err error
+	doc["meta"], err = json.Marshal(new(vaultMeta))
+	return err
+}
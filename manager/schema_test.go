@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// findKey looks for a json object key anywhere in the document
+func findKey(doc interface{}, key string) bool {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if k == key || findKey(value, key) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if findKey(value, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func checkRoundTrip(t *testing.T, data []byte, v interface{}, keys ...string) {
+	t.Helper()
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc interface{}
+	err = json.Unmarshal(out, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if !findKey(doc, key) {
+			t.Errorf("unknown field %s lost in %s", key, out)
+		}
+	}
+}
+
+func TestIndexKeepsUnknownFields(t *testing.T) {
+	data := []byte(`{
+		"schema": 2,
+		"future_index": 1,
+		"meta": {"created_at": "2020-01-01T00:00:00Z", "future_meta": 1},
+		"entries": {
+			"e1": {
+				"id": "e1",
+				"name": "mail",
+				"future_entry": 1,
+				"fields": {"pin": {"type": "secret", "future_field": 1}},
+				"attachments": [{"name": "a.txt", "blob_id": "b1", "future_attachment": 1}]
+			}
+		},
+		"tag_policies": {"bank": {"rotate_every": "90d", "future_policy": 1}}
+	}`)
+
+	idx, schema, err := parseIndex(data, vaultVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema != schemaVersion {
+		t.Errorf("schema %d, want %d", schema, schemaVersion)
+	}
+	out, err := json.Marshal(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrip(t, out, new(passdbIndex),
+		"future_index", "future_meta", "future_entry", "future_field", "future_attachment", "future_policy")
+
+	si := idx.Entries["e1"]
+	if si.Fields["pin"].Type != fieldSecret || si.Attachments[0].BlobID != "b1" {
+		t.Errorf("known fields lost: %+v", si)
+	}
+}
+
+func TestSecretKeepsUnknownFields(t *testing.T) {
+	data := []byte(`{
+		"password": "new",
+		"future_secret": 1,
+		"history": [{"password": "old", "changed_at": "2020-01-01T00:00:00Z", "future_record": 1}]
+	}`)
+	secret := new(serviceSecret)
+	checkRoundTrip(t, data, secret, "future_secret", "future_record")
+	if len(secret.History) != 1 || secret.History[0].Password != "old" {
+		t.Errorf("history lost: %+v", secret.History)
+	}
+}
+
+func TestVaultFileKeepsUnknownFields(t *testing.T) {
+	data := []byte(`{"version": 4, "id": "v1", "future_vault": 1, "members": [{"name": "alice", "future_member": 1}]}`)
+	checkRoundTrip(t, data, new(vaultFile), "future_vault", "future_member")
+}
+
+func TestSealedSecretKeepsUnknownFields(t *testing.T) {
+	data := []byte(`{"name": "mail", "secret": {"key": "AQI=", "data": "AwQ=", "future_sealed": 1}}`)
+	si := new(ServiceInfo)
+	checkRoundTrip(t, data, si, "future_sealed")
+	if string(si.Secret.Key) != "\x01\x02" || string(si.Secret.Data) != "\x03\x04" {
+		t.Errorf("known fields lost: %+v", si.Secret)
+	}
+}
+
+func TestGeneratorPolicyKeepsUnknownFields(t *testing.T) {
+	data := []byte(`{"rotate_every": "90d", "generate": {"length": 16, "digits": true, "future_generate": 1}}`)
+	p := new(tagPolicy)
+	checkRoundTrip(t, data, p, "future_generate")
+	if p.Generate == nil || p.Generate.Length != 16 || !p.Generate.Digits {
+		t.Errorf("generator policy lost: %+v", p.Generate)
+	}
+
+	// a policy without a generator gets none on save
+	out, err := json.Marshal(&tagPolicy{RotateEvery: "90d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"rotate_every":"90d"}` {
+		t.Errorf("policy marshalled to %s", out)
+	}
+}
+
+func TestMigrateLegacyIndex(t *testing.T) {
+	// schema 0 entries are keyed by names and have no ids
+	data := []byte(`{"entries": {"mail": {"name": "mail", "username": "bob", "future_entry": 1}}}`)
+	idx, schema, err := parseIndex(data, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema != 0 {
+		t.Errorf("schema %d, want 0", schema)
+	}
+	if idx.Schema != schemaVersion || idx.Meta == nil {
+		t.Errorf("index not migrated: schema %d, meta %v", idx.Schema, idx.Meta)
+	}
+	if len(idx.Entries) != 1 {
+		t.Fatalf("%d entries, want 1", len(idx.Entries))
+	}
+	for id, si := range idx.Entries {
+		if id == "mail" || si.ID != id || si.Username != "bob" || si.extra["future_entry"] == nil {
+			t.Errorf("entry not migrated: %s %+v", id, si)
+		}
+	}
+}
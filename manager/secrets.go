@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"encoding/json"
+
+	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/secmem"
+)
+
+const (
+	maxPasswordHistory = 10
+)
+
+// serviceSecret holds the sensitive part of a service entry
+type serviceSecret struct {
+	Password string            `json:"password"`
+	History  []passwordRecord  `json:"history,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	// TOTP is an otpauth:// URI of the service 2FA key
+	TOTP string `json:"totp,omitempty"`
+	// Note is the text of a secure note entry
+	Note string `json:"note,omitempty"`
+	// AttachmentKeys are attachment blob keys by blob ids
+	AttachmentKeys map[string][]byte `json:"attachment_keys,omitempty"`
+	extra          unknownFields
+}
+
+// passwordRecord is a previous password of a service
+// along with the time it was replaced at
+type passwordRecord struct {
+	Password  string `json:"password"`
+	ChangedAt string `json:"changed_at"`
+	extra     unknownFields
+}
+
+// setPassword changes the password keeping the previous one in history,
+// it returns false if the password is the same
+func (s *serviceSecret) setPassword(pwd string) bool {
+	if pwd == s.Password {
+		return false
+	}
+	if s.Password != "" {
+		record := passwordRecord{Password: s.Password, ChangedAt: timestamp()}
+		s.History = append([]passwordRecord{record}, s.History...)
+		if len(s.History) > maxPasswordHistory {
+			s.History = s.History[:maxPasswordHistory]
+		}
+	}
+	s.Password = pwd
+	return true
+}
+
+// sealedSecret is a serviceSecret encrypted with its own entry key,
+// the entry key itself is encrypted with the vault data key. Unknown
+// fields are kept until the secret is sealed anew.
+type sealedSecret struct {
+	Key   []byte `json:"key"`
+	Data  []byte `json:"data"`
+	extra unknownFields
+}
+
+func sealSecret(secret *serviceSecret, dataKey []byte) (*sealedSecret, error) {
+	entryKey, err := crypter.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	defer secmem.Wipe(entryKey)
+
+	data, err := json.Marshal(secret)
+	if err != nil {
+		return nil, err
+	}
+	defer secmem.Wipe(data)
+
+	ss := new(sealedSecret)
+	ss.Data, err = crypter.EncryptWithKey(data, entryKey)
+	if err != nil {
+		return nil, err
+	}
+	ss.Key, err = crypter.EncryptWithKey(entryKey, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+func (ss *sealedSecret) open(dataKey []byte) (*serviceSecret, error) {
+	secret := new(serviceSecret)
+	if ss == nil {
+		return secret, nil
+	}
+
+	entryKey, err := crypter.DecryptWithKey(ss.Key, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	defer secmem.Wipe(entryKey)
+
+	data, err := crypter.DecryptWithKey(ss.Data, entryKey)
+	if err != nil {
+		return nil, err
+	}
+	defer secmem.Wipe(data)
+
+	err = json.Unmarshal(data, secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// rekey re-encrypts the secret with a fresh entry key wrapped with a new data key
+func (ss *sealedSecret) rekey(oldKey []byte, newKey []byte) (*sealedSecret, error) {
+	secret, err := ss.open(oldKey)
+	if err != nil {
+		return nil, err
+	}
+	return sealSecret(secret, newKey)
+}
+
+func (m *Manager) revealSecret(si *ServiceInfo) (*serviceSecret, error) {
+	return si.Secret.open(m.dataKey.Bytes())
+}
+
+func (m *Manager) setSecret(si *ServiceInfo, secret *serviceSecret) error {
+	ss, err := sealSecret(secret, m.dataKey.Bytes())
+	if err != nil {
+		return err
+	}
+	si.Secret = ss
+	return nil
+}
+
+// rekeyEntries re-encrypts every entry including the trash ones for a new vault data key
+func (m *Manager) rekeyEntries(newKey []byte) error {
+	rekeyed := make(map[*ServiceInfo]*sealedSecret)
+	for _, sd := range []serviceData{m.data, m.trash} {
+		for _, si := range sd {
+			ss, err := si.Secret.rekey(m.dataKey.Bytes(), newKey)
+			if err != nil {
+				return err
+			}
+			rekeyed[si] = ss
+		}
+	}
+
+	dataKey, err := secmem.New(len(newKey))
+	if err != nil {
+		return err
+	}
+	copy(dataKey.Bytes(), newKey)
+
+	for si, ss := range rekeyed {
+		si.Secret = ss
+	}
+	m.dataKey.Destroy()
+	m.dataKey = dataKey
+	return nil
+}
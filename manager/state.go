@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/viert/yanpassword/term"
+)
+
+const (
+	stateFilename = ".yanpasswd_state"
+)
+
+// localState keeps data yanpassword needs to remember between sessions
+type localState struct {
+	// Revisions are the last seen revisions of vaults by vault id
+	Revisions map[string]int64 `json:"revisions"`
+	// AuthRevisions are the last seen auth data revisions by auth store
+	AuthRevisions map[string]int64 `json:"auth_revisions,omitempty"`
+}
+
+func getStateFilename() string {
+	return path.Join(os.Getenv("HOME"), stateFilename)
+}
+
+func loadState() (*localState, error) {
+	st := &localState{Revisions: make(map[string]int64), AuthRevisions: make(map[string]int64)}
+
+	data, err := ioutil.ReadFile(getStateFilename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, st)
+	if err != nil {
+		return nil, err
+	}
+	if st.Revisions == nil {
+		st.Revisions = make(map[string]int64)
+	}
+	if st.AuthRevisions == nil {
+		st.AuthRevisions = make(map[string]int64)
+	}
+	return st, nil
+}
+
+func (st *localState) save() error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(getStateFilename(), data, os.FileMode(0600))
+}
+
+// checkRevision warns if the vault revision goes backwards compared
+// to the last one seen locally, which means the vault has been rolled back
+func (m *Manager) checkRevision(vaultID string, revision int64) {
+	lastSeen, found := m.state.Revisions[vaultID]
+	if found && revision < lastSeen {
+		term.Warnf(
+			"Vault revision %d is older than revision %d seen last time. "+
+				"The remote data may have been rolled back to an older backup!\n",
+			revision,
+			lastSeen,
+		)
+		return
+	}
+	m.recordRevision(vaultID, revision)
+}
+
+func (m *Manager) recordRevision(vaultID string, revision int64) {
+	m.state.Revisions[vaultID] = revision
+	err := m.state.save()
+	if err != nil {
+		term.Errorf("Error saving state file %s: %s\n", getStateFilename(), err)
+	}
+}
+
+func (m *Manager) recordAuthRevision(store string, revision int64) {
+	m.state.AuthRevisions[store] = revision
+	err := m.state.save()
+	if err != nil {
+		term.Errorf("Error saving state file %s: %s\n", getStateFilename(), err)
+	}
+}
@@ -0,0 +1,57 @@
+package manager
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/viert/yanpassword/strength"
+	"github.com/viert/yanpassword/term"
+)
+
+const (
+	defaultMinMasterPasswordScore = strength.Fair
+)
+
+// strengthInputs returns the entry data a password is likely to be based on
+func (si *ServiceInfo) strengthInputs() []string {
+	inputs := []string{si.Name, si.Username}
+	if u, err := url.Parse(si.URL); err == nil && u.Hostname() != "" {
+		host := strings.TrimPrefix(u.Hostname(), "www.")
+		inputs = append(inputs, host, strings.Split(host, ".")[0])
+	}
+	return inputs
+}
+
+// checkStrength shows the password strength estimate along with the
+// warnings, it returns false if the score is below the minimum
+func checkStrength(pwd []byte, minScore int, userInputs ...string) bool {
+	res := strength.Estimate(pwd, userInputs...)
+	estimate := fmt.Sprintf("%s (%d/%d), ~%.0f bits", res.Label(), res.Score, strength.Strong, res.Bits)
+	if res.Score < strength.Fair {
+		estimate = term.Red(estimate)
+	}
+	fmt.Printf("Strength: %s\n", estimate)
+	for _, warning := range res.Warnings {
+		term.Warnf("  %s\n", warning)
+	}
+
+	if res.Score < minScore {
+		term.Errorf("Password is too weak, the minimum score is %d\n", minScore)
+		return false
+	}
+	return true
+}
+
+// acceptPassword checks the strength of a service password, a password
+// weaker than the configured minimum is rejected unless weak passwords
+// are allowed in config and the user confirms it
+func (m *Manager) acceptPassword(si *ServiceInfo, pwd []byte) bool {
+	if checkStrength(pwd, m.config.MinPasswordScore, si.strengthInputs()...) {
+		return true
+	}
+	if !m.config.AllowWeakPasswords {
+		return false
+	}
+	return confirm("Use it anyway?")
+}
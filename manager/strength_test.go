@@ -0,0 +1,30 @@
+package manager
+
+import "testing"
+
+func TestAcceptPassword(t *testing.T) {
+	m := newTestManager(t)
+	si := &ServiceInfo{Name: "github"}
+	m.config.MinPasswordScore = 3
+
+	restore := withStdin("y\n")
+	accepted := m.acceptPassword(si, []byte("password"))
+	restore()
+	if accepted {
+		t.Error("a weak password accepted with weak passwords not allowed")
+	}
+
+	m.config.AllowWeakPasswords = true
+	for input, want := range map[string]bool{"y\n": true, "n\n": false} {
+		restore = withStdin(input)
+		accepted = m.acceptPassword(si, []byte("password"))
+		restore()
+		if accepted != want {
+			t.Errorf("weak password accepted %v answering %q", accepted, input)
+		}
+	}
+
+	if !m.acceptPassword(si, []byte("x9$Lq2!vR7#m")) {
+		t.Error("a strong password rejected")
+	}
+}
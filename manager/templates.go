@@ -0,0 +1,451 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/viert/yanpassword/term"
+)
+
+// Typed entry types in addition to entryLogin and entryNote
+const (
+	entryCard     = "card"
+	entrySSHKey   = "ssh"
+	entryDatabase = "database"
+	entryServer   = "server"
+
+	// template field names stored in the standard entry fields
+	templateUsername = "username"
+	templatePassword = "password"
+)
+
+var (
+	entryTypes = []string{entryLogin, entryNote, entryCard, entrySSHKey, entryDatabase, entryServer}
+)
+
+// templateField describes a field of a typed entry. The username and password
+// fields are kept in the standard entry fields, the others are kept as custom
+// fields so they are sealed, exported and imported the usual way.
+type templateField struct {
+	Name      string
+	Label     string
+	Hint      string
+	Type      string
+	Multiline bool
+	Required  bool
+	// Password fields get their strength checked
+	Password bool
+	Validate func(string) error
+}
+
+// entryTemplate is a schema of a typed entry
+type entryTemplate struct {
+	Fields []*templateField
+	// Primary is the field printed by getpass
+	Primary string
+}
+
+var entryTemplates = map[string]*entryTemplate{
+	entryCard: {
+		Fields: []*templateField{
+			{Name: "holder", Label: "Card holder", Type: fieldText},
+			{Name: "number", Label: "Card number", Type: fieldSecret, Required: true, Validate: validateCardNumber},
+			{Name: "expiry", Label: "Expiry", Hint: "MM/YY", Type: fieldText, Validate: validateCardExpiry},
+			{Name: "cvv", Label: "CVV", Type: fieldSecret, Validate: validateCVV},
+		},
+		Primary: "number",
+	},
+	entrySSHKey: {
+		Fields: []*templateField{
+			{Name: templateUsername, Label: "Username", Type: fieldText},
+			{
+				Name:      "private_key",
+				Label:     "Private key",
+				Type:      fieldSecret,
+				Multiline: true,
+				Required:  true,
+				Validate:  validatePrivateKey,
+			},
+			{Name: "public_key", Label: "Public key", Type: fieldText, Validate: validatePublicKey},
+			{Name: templatePassword, Label: "Passphrase", Type: fieldSecret},
+		},
+		Primary: "private_key",
+	},
+	entryDatabase: {
+		Fields: []*templateField{
+			{Name: "host", Label: "Host", Type: fieldText, Required: true},
+			{Name: "port", Label: "Port", Type: fieldText, Validate: validatePort},
+			{Name: "database", Label: "Database", Type: fieldText},
+			{Name: templateUsername, Label: "User", Type: fieldText},
+			{Name: templatePassword, Label: "Password", Type: fieldSecret, Password: true},
+		},
+		Primary: templatePassword,
+	},
+	entryServer: {
+		Fields: []*templateField{
+			{Name: "host", Label: "Host", Type: fieldText, Required: true},
+			{Name: "ip", Label: "IP", Type: fieldText, Validate: validateIP},
+			{Name: templateUsername, Label: "User", Type: fieldText},
+			{Name: templatePassword, Label: "Root password", Type: fieldSecret, Password: true},
+		},
+		Primary: templatePassword,
+	},
+}
+
+func normalizeEntryType(etype string) (string, error) {
+	etype = strings.ToLower(etype)
+	switch etype {
+	case "":
+		return entryLogin, nil
+	case "ssh-key", "sshkey":
+		return entrySSHKey, nil
+	case "db":
+		return entryDatabase, nil
+	}
+	for _, t := range entryTypes {
+		if t == etype {
+			return etype, nil
+		}
+	}
+	return "", fmt.Errorf("unknown entry type %s, valid types are %s", etype, strings.Join(entryTypes, ", "))
+}
+
+// entryType returns the type of the entry, entries without type are logins
+func (si *ServiceInfo) entryType() string {
+	if si.Type == "" {
+		return entryLogin
+	}
+	return si.Type
+}
+
+// template returns the schema of a typed entry or nil for logins and notes
+func (si *ServiceInfo) template() *entryTemplate {
+	return entryTemplates[si.Type]
+}
+
+func (t *entryTemplate) field(name string) *templateField {
+	for _, tf := range t.Fields {
+		if tf.Name == name {
+			return tf
+		}
+	}
+	return nil
+}
+
+func (t *entryTemplate) has(name string) bool {
+	return t.field(name) != nil
+}
+
+func templateValue(si *ServiceInfo, secret *serviceSecret, tf *templateField) string {
+	switch tf.Name {
+	case templateUsername:
+		return si.Username
+	case templatePassword:
+		return secret.Password
+	}
+	if tf.Type == fieldSecret {
+		return secret.Fields[tf.Name]
+	}
+	if field, found := si.Fields[tf.Name]; found {
+		return field.Value
+	}
+	return ""
+}
+
+func setTemplateValue(si *ServiceInfo, secret *serviceSecret, tf *templateField, value string) {
+	switch tf.Name {
+	case templateUsername:
+		si.Username = value
+		return
+	case templatePassword:
+		si.setPassword(secret, value)
+		return
+	}
+
+	delete(secret.Fields, tf.Name)
+	if value == "" {
+		delete(si.Fields, tf.Name)
+		return
+	}
+
+	if si.Fields == nil {
+		si.Fields = make(map[string]*customField)
+	}
+	if tf.Type == fieldSecret {
+		if secret.Fields == nil {
+			secret.Fields = make(map[string]string)
+		}
+		secret.Fields[tf.Name] = value
+		si.Fields[tf.Name] = &customField{Type: fieldSecret}
+	} else {
+		si.Fields[tf.Name] = &customField{Type: tf.Type, Value: value}
+	}
+}
+
+// readTemplateField prompts for a template field value,
+// an empty input keeps the current value and !clear removes it
+func (m *Manager) readTemplateField(si *ServiceInfo, tf *templateField, current string) (string, error) {
+	prompt := tf.Label
+	if tf.Hint != "" {
+		prompt += " (" + tf.Hint + ")"
+	}
+	if tf.Multiline {
+		prompt += " (<<END or !edit for multiple lines)"
+	}
+	if current != "" {
+		if tf.Type == fieldSecret {
+			prompt += " [" + maskedValue + "]"
+		} else if !strings.Contains(current, "\n") {
+			prompt += " [" + current + "]"
+		}
+	}
+	prompt += ": "
+
+	for {
+		var input, value string
+		var err error
+		if tf.Type == fieldSecret {
+			pwd, rerr := m.rl.ReadPassword(prompt)
+			if rerr != nil {
+				return "", rerr
+			}
+			input = string(pwd)
+		} else {
+			input, err = getString(prompt)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if input == clearValue {
+			if tf.Required {
+				term.Errorf("%s is required and can't be cleared\n", tf.Label)
+				continue
+			}
+			return "", nil
+		}
+		if tf.Type == fieldSecret && tf.Name == templatePassword {
+			value, err = m.expandPassword(si, input)
+		} else {
+			value, err = expandText(input, current)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if value == "" {
+			value = current
+		}
+		if value == "" {
+			if !tf.Required {
+				return "", nil
+			}
+			term.Errorf("%s is required\n", tf.Label)
+			continue
+		}
+
+		if tf.Validate != nil {
+			err = tf.Validate(value)
+		} else {
+			err = validateField(tf.Type, value)
+		}
+		if err != nil {
+			term.Errorf("Invalid %s: %s\n", strings.ToLower(tf.Label), err)
+			continue
+		}
+		if tf.Password && value != current && !m.acceptPassword(si, []byte(value)) {
+			continue
+		}
+		return value, nil
+	}
+}
+
+// setTemplateField prompts for a single field of a typed entry keeping
+// the field type of the template, so secret fields stay sealed
+func (m *Manager) setTemplateField(si *ServiceInfo, secret *serviceSecret, tf *templateField) {
+	value, err := m.readTemplateField(si, tf, templateValue(si, secret, tf))
+	if err != nil {
+		term.Errorf("%s\n", err)
+		return
+	}
+	setTemplateValue(si, secret, tf, value)
+
+	err = m.setSecret(si, secret)
+	if err != nil {
+		term.Errorf("Error encrypting service %s: %s\n", si.Name, err)
+		return
+	}
+	si.touch()
+
+	if value == "" {
+		term.Successf("Field %s removed. Don't forget to **save** the result.\n", tf.Name)
+	} else {
+		term.Successf("Field %s set. Don't forget to **save** the result.\n", tf.Name)
+	}
+}
+
+// setTyped prompts for the fields of a typed entry
+func (m *Manager) setTyped(si *ServiceInfo, secret *serviceSecret) error {
+	tmpl := si.template()
+	for _, tf := range tmpl.Fields {
+		value, err := m.readTemplateField(si, tf, templateValue(si, secret, tf))
+		if err != nil {
+			return err
+		}
+		setTemplateValue(si, secret, tf, value)
+	}
+
+	prompt := "Comment: "
+	if si.Comment != "" {
+		prompt = "Comment (!clear to remove): "
+	}
+	input, err := getString(prompt)
+	if err != nil {
+		return err
+	}
+	if input == clearValue {
+		si.Comment = ""
+		return nil
+	}
+	comment, err := expandText(input, si.Comment)
+	if err != nil {
+		return err
+	}
+	if comment != "" {
+		si.Comment = comment
+	}
+	return nil
+}
+
+// printTemplate prints the fields of a typed entry in the template order,
+// secret fields are masked unless reveal is set
+func printTemplate(si *ServiceInfo, secret *serviceSecret, reveal bool) {
+	for _, tf := range si.template().Fields {
+		value := templateValue(si, secret, tf)
+		if value == "" {
+			continue
+		}
+		if tf.Type == fieldSecret && !reveal {
+			value = maskTemplateValue(tf, value)
+		}
+		printValue(tf.Label, value)
+	}
+}
+
+func maskTemplateValue(tf *templateField, value string) string {
+	if tf.Name == "number" {
+		digits := cardDigits(value)
+		if len(digits) > 4 {
+			return maskedValue + " " + digits[len(digits)-4:]
+		}
+	}
+	return maskedValue
+}
+
+// primaryValue returns the value printed by getpass
+func primaryValue(si *ServiceInfo, secret *serviceSecret) string {
+	if si.isNote() {
+		return secret.Note
+	}
+	tmpl := si.template()
+	if tmpl == nil {
+		return secret.Password
+	}
+	for _, tf := range tmpl.Fields {
+		if tf.Name == tmpl.Primary {
+			return templateValue(si, secret, tf)
+		}
+	}
+	return secret.Password
+}
+
+func cardDigits(number string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, number)
+}
+
+// validateCardNumber checks the card number with the Luhn algorithm
+func validateCardNumber(number string) error {
+	digits := cardDigits(number)
+	if len(digits) < 12 || len(digits) > 19 {
+		return errors.New("a card number has 12 to 19 digits")
+	}
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := digits[len(digits)-1-i]
+		if d < '0' || d > '9' {
+			return errors.New("a card number must contain digits only")
+		}
+		n := int(d - '0')
+		if i%2 == 1 {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	if sum%10 != 0 {
+		return errors.New("checksum mismatch, check for typos")
+	}
+	return nil
+}
+
+func validateCardExpiry(expiry string) error {
+	for _, layout := range []string{"01/06", "01/2006"} {
+		if _, err := time.Parse(layout, expiry); err == nil {
+			return nil
+		}
+	}
+	return errors.New("expiry date must be in MM/YY format")
+}
+
+func validateCVV(cvv string) error {
+	if len(cvv) < 3 || len(cvv) > 4 {
+		return errors.New("CVV has 3 or 4 digits")
+	}
+	for _, c := range cvv {
+		if c < '0' || c > '9' {
+			return errors.New("CVV must contain digits only")
+		}
+	}
+	return nil
+}
+
+func validatePrivateKey(key string) error {
+	if !strings.Contains(key, "PRIVATE KEY") {
+		return errors.New("not a PEM or OpenSSH private key")
+	}
+	return nil
+}
+
+func validatePublicKey(key string) error {
+	fields := strings.Fields(key)
+	if len(fields) < 2 || !(strings.HasPrefix(fields[0], "ssh-") || strings.HasPrefix(fields[0], "ecdsa-")) {
+		return errors.New("not an OpenSSH public key")
+	}
+	return nil
+}
+
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return errors.New("port must be a number from 1 to 65535")
+	}
+	return nil
+}
+
+func validateIP(ip string) error {
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("%s is not an IP address", ip)
+	}
+	return nil
+}
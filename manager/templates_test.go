@@ -0,0 +1,39 @@
+package manager
+
+import "testing"
+
+func TestValidateCVV(t *testing.T) {
+	for _, cvv := range []string{"123", "0123"} {
+		if err := validateCVV(cvv); err != nil {
+			t.Errorf("CVV %s rejected: %s", cvv, err)
+		}
+	}
+	for _, cvv := range []string{"12", "12345", "+12", "-12", "1 2", "12a", "１２３"} {
+		if validateCVV(cvv) == nil {
+			t.Errorf("CVV %q accepted", cvv)
+		}
+	}
+}
+
+func TestSetTemplateField(t *testing.T) {
+	m := newTestManager(t)
+	si := addTestService(t, m, "visa", "")
+	si.Type = entryCard
+
+	// no field type is asked for template fields
+	restore := withStdin("12/30\n")
+	m.setField(si, "expiry")
+	restore()
+
+	field, found := si.Fields["expiry"]
+	if !found || field.Type != fieldText || field.Value != "12/30" {
+		t.Fatalf("expiry field %+v", field)
+	}
+	secret, err := m.revealSecret(si)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := templateValue(si, secret, entryTemplates[entryCard].field("expiry")); value != "12/30" {
+		t.Errorf("template value %q, want 12/30", value)
+	}
+}
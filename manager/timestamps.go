@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"time"
+)
+
+const (
+	displayTimeFormat = "2006-01-02 15:04:05"
+)
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// parseTimestamp parses entry timestamps, ok is false for empty
+// or malformed timestamps e.g. the ones set by other tools
+func parseTimestamp(ts string) (t time.Time, ok bool) {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return t, false
+	}
+	return t, true
+}
+
+func displayTimestamp(ts string) string {
+	t, ok := parseTimestamp(ts)
+	if !ok {
+		return ts
+	}
+	return t.Local().Format(displayTimeFormat)
+}
+
+// touch sets the entry modification time and its creation time if not set yet
+func (si *ServiceInfo) touch() {
+	si.UpdatedAt = timestamp()
+	if si.CreatedAt == "" {
+		si.CreatedAt = si.UpdatedAt
+	}
+}
+
+// updatedTime returns the entry modification time falling back to its creation time,
+// zero time is returned for entries with no timestamps at all
+func (si *ServiceInfo) updatedTime() time.Time {
+	if t, ok := parseTimestamp(si.UpdatedAt); ok {
+		return t
+	}
+	t, _ := parseTimestamp(si.CreatedAt)
+	return t
+}
@@ -0,0 +1,21 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// the RFC 6238 SHA1 key, the vectors are tested in the totp package
+	uri := "otpauth://totp/RFC6238:test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	code, remaining, err := totpCode(uri, time.Unix(1111111109, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "07081804" || remaining != 1*time.Second {
+		t.Errorf("totpCode() = %s, %s, want 07081804, 1s", code, remaining)
+	}
+	if _, _, err = totpCode("otpauth://totp/test", time.Now()); err == nil {
+		t.Error("URI with no secret accepted")
+	}
+}
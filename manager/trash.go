@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/viert/yanpassword/term"
+)
+
+const (
+	defaultTrashRetention = "30d"
+	// trashKeepForever disables purging the trash automatically
+	trashKeepForever = "never"
+)
+
+func (si *ServiceInfo) deletedTime() time.Time {
+	t, _ := parseTimestamp(si.DeletedAt)
+	return t
+}
+
+// parseRetention parses the trash_retention setting,
+// zero means the trash is never purged
+func parseRetention(setting string) (time.Duration, error) {
+	if setting == trashKeepForever {
+		return 0, nil
+	}
+	retention, err := parseAge(setting)
+	if err != nil {
+		return 0, err
+	}
+	if retention <= 0 {
+		return 0, fmt.Errorf("retention %s is not positive", setting)
+	}
+	return retention, nil
+}
+
+// moveToTrash removes the entry from the list keeping it in the trash
+func (m *Manager) moveToTrash(si *ServiceInfo) {
+	m.remove(si)
+	si.DeletedAt = timestamp()
+	m.trash[si.ID] = si
+}
+
+// trashed returns the trash entries sorted by deletion time, the most recent first
+func (m *Manager) trashed() []*ServiceInfo {
+	items := make([]*ServiceInfo, 0, len(m.trash))
+	for _, si := range m.trash {
+		items = append(items, si)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		ti, tj := items[i].deletedTime(), items[j].deletedTime()
+		if ti.Equal(tj) {
+			return items[i].Name < items[j].Name
+		}
+		return ti.After(tj)
+	})
+	return items
+}
+
+// purgeTrash removes trash entries deleted longer than the configured period ago.
+// Entries with no valid deletion time are stamped with the current time
+// so that they're kept for the retention period rather than purged at once.
+func (m *Manager) purgeTrash() int {
+	retention, err := parseRetention(m.config.TrashRetention)
+	if err != nil {
+		term.Errorf("Invalid trash_retention setting: %s\n", err)
+		return 0
+	}
+	if retention == 0 {
+		return 0
+	}
+
+	threshold := time.Now().Add(-retention)
+	purged := 0
+	for id, si := range m.trash {
+		deleted, ok := parseTimestamp(si.DeletedAt)
+		if !ok {
+			si.DeletedAt = timestamp()
+			continue
+		}
+		if deleted.Before(threshold) {
+			delete(m.trash, id)
+			purged++
+		}
+	}
+	return purged
+}
+
+func (m *Manager) doTrash(name string, argsLine string, args ...string) {
+	items := m.trashed()
+	if len(items) == 0 {
+		term.Warnf("Trash is empty\n")
+		return
+	}
+
+	width := 0
+	for _, si := range items {
+		if len(si.Name) > width {
+			width = len(si.Name)
+		}
+	}
+	for _, si := range items {
+		fmt.Printf("%-*s  deleted %s\n", width, si.Name, displayTimestamp(si.DeletedAt))
+	}
+	if m.config.TrashRetention != trashKeepForever {
+		fmt.Printf("\nEntries are purged %s after deletion\n", m.config.TrashRetention)
+	}
+}
+
+func (m *Manager) doUndelete(name string, argsLine string, args ...string) {
+	if len(args) < 1 {
+		term.Errorf("%s command requires a service name\n", name)
+		return
+	}
+
+	serviceName := args[0]
+	if _, found := m.lookup(serviceName); found {
+		term.Errorf("Service %s already exists, rename it before restoring the deleted one\n", serviceName)
+		return
+	}
+
+	// the most recently deleted entry wins if there are a few with the same name
+	for _, si := range m.trashed() {
+		if si.Name != serviceName {
+			continue
+		}
+		delete(m.trash, si.ID)
+		si.DeletedAt = ""
+		err := m.put(si)
+		if err != nil {
+			term.Errorf("Error restoring service %s: %s\n", serviceName, err)
+			return
+		}
+		term.Successf("Service %s restored. Don't forget to **save** the result.\n", serviceName)
+		return
+	}
+	term.Errorf("Service %s not found in trash\n", serviceName)
+}
+
+func (m *Manager) doEmptyTrash(name string, argsLine string, args ...string) {
+	if len(m.trash) == 0 {
+		term.Warnf("Trash is empty\n")
+		return
+	}
+	count := len(m.trash)
+	m.trash = make(serviceData)
+	term.Successf("%d entries removed from trash. Don't forget to **save** the result.\n", count)
+}
+
+// trashCompleter completes names of deleted services
+func (m *Manager) trashCompleter() completeFunc {
+	return func(line []rune) (newLine [][]rune, length int) {
+		seen := make(map[string]bool)
+		sr := make([]string, 0)
+		for _, si := range m.trash {
+			if !seen[si.Name] && strings.HasPrefix(si.Name, string(line)) {
+				seen[si.Name] = true
+				sr = append(sr, si.Name[len(line):])
+			}
+		}
+		sort.Strings(sr)
+		return toRunes(sr), len(line)
+	}
+}
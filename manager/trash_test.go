@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurgeTrash(t *testing.T) {
+	m := newTestManager(t)
+	deletedAt := map[string]string{
+		"old":     time.Now().Add(-60 * 24 * time.Hour).UTC().Format(time.RFC3339),
+		"recent":  timestamp(),
+		"missing": "",
+		"invalid": "yesterday",
+	}
+	for name, ts := range deletedAt {
+		si := addTestService(t, m, name, "secret")
+		m.moveToTrash(si)
+		si.DeletedAt = ts
+	}
+
+	if purged := m.purgeTrash(); purged != 1 {
+		t.Errorf("%d entries purged, want 1", purged)
+	}
+	for _, si := range m.trashed() {
+		if si.Name == "old" {
+			t.Error("entry deleted 60 days ago kept")
+		}
+		if _, ok := parseTimestamp(si.DeletedAt); !ok {
+			t.Errorf("entry %s with no deletion time not stamped", si.Name)
+		}
+	}
+	if len(m.trash) != 3 {
+		t.Errorf("%d entries left in trash, want 3", len(m.trash))
+	}
+
+	m.config.TrashRetention = trashKeepForever
+	for _, si := range m.trash {
+		si.DeletedAt = deletedAt["old"]
+	}
+	if purged := m.purgeTrash(); purged != 0 {
+		t.Errorf("%d entries purged with trash kept forever", purged)
+	}
+}
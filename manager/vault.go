@@ -0,0 +1,220 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/secmem"
+)
+
+const (
+	vaultMagic = "YNPV"
+	// vault version 1 payload is a plain service map,
+	// version 2 payload is a passdbIndex with per-entry sealed secrets,
+	// version 3 payload is authenticated along with the vault blobContext,
+	// version 4 payload entries are keyed by entry ids
+	vaultVersion = 4
+
+	roleAuth       = "auth"
+	rolePassdb     = "passdb"
+	roleAttachment = "attachment"
+	roleRecovery   = "recovery"
+)
+
+var (
+	errNotVaultMember = errors.New("you are not a member of this vault")
+)
+
+// vaultMember is a vault recipient, the vault data key is wrapped
+// for every member's public key
+type vaultMember struct {
+	Name       string `json:"name"`
+	PublicKey  []byte `json:"public_key"`
+	WrappedKey []byte `json:"wrapped_key"`
+	// Recovery is the data key sealed with the member's master password,
+	// it opens the vault for a new key pair if the auth data is lost
+	Recovery []byte `json:"recovery,omitempty"`
+	extra    unknownFields
+}
+
+// vaultFile is the on-disk representation of a multi-recipient vault
+type vaultFile struct {
+	Version int    `json:"version"`
+	ID      string `json:"id"`
+	// Revision is incremented every time the vault is saved
+	Revision int64 `json:"revision"`
+	// Generation is incremented every time the vault is rekeyed
+	Generation int            `json:"generation"`
+	Members    []*vaultMember `json:"members"`
+	Data       []byte         `json:"data"`
+	extra      unknownFields
+}
+
+// blobContext is authenticated along with the encrypted data,
+// binding the data to a vault, a file role and a revision
+type blobContext struct {
+	VaultID  string `json:"vault_id,omitempty"`
+	Role     string `json:"role"`
+	Revision int64  `json:"revision,omitempty"`
+	BlobID   string `json:"blob_id,omitempty"`
+}
+
+func (bc *blobContext) dump() []byte {
+	data, _ := json.Marshal(bc)
+	return data
+}
+
+func newVaultID() (string, error) {
+	id := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func (vf *vaultFile) context() []byte {
+	bc := &blobContext{VaultID: vf.ID, Role: rolePassdb, Revision: vf.Revision}
+	return bc.dump()
+}
+
+func isVaultFile(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(vaultMagic))
+}
+
+func parseVaultFile(data []byte) (*vaultFile, error) {
+	vf := new(vaultFile)
+	err := json.Unmarshal(data[len(vaultMagic):], vf)
+	if err != nil {
+		return nil, err
+	}
+	if vf.Version > vaultVersion {
+		return nil, fmt.Errorf("unsupported vault version %d, please upgrade yanpassword", vf.Version)
+	}
+	if vf.Version >= 3 && vf.ID == "" {
+		return nil, errors.New("vault has no id")
+	}
+	return vf, nil
+}
+
+func (vf *vaultFile) dump() ([]byte, error) {
+	data, err := json.Marshal(vf)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(vaultMagic), data...), nil
+}
+
+func (vf *vaultFile) findMember(publicKey []byte) *vaultMember {
+	for _, member := range vf.Members {
+		if bytes.Equal(member.PublicKey, publicKey) {
+			return member
+		}
+	}
+	return nil
+}
+
+// open unwraps the vault data key with a member's private key
+// and decrypts the vault contents
+func (vf *vaultFile) open(publicKey []byte, privateKey []byte) (data []byte, dataKey []byte, err error) {
+	member := vf.findMember(publicKey)
+	if member == nil {
+		return nil, nil, errNotVaultMember
+	}
+
+	dataKey, err = crypter.UnwrapKey(member.WrappedKey, privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err = vf.decrypt(dataKey)
+	if err != nil {
+		secmem.Wipe(dataKey)
+		return nil, nil, err
+	}
+	return data, dataKey, nil
+}
+
+func (vf *vaultFile) decrypt(dataKey []byte) ([]byte, error) {
+	if vf.Version >= 3 {
+		return crypter.DecryptWithKeyAD(vf.Data, dataKey, vf.context())
+	}
+	return crypter.DecryptWithKey(vf.Data, dataKey)
+}
+
+func (vf *vaultFile) recoveryContext() []byte {
+	bc := &blobContext{VaultID: vf.ID, Role: roleRecovery}
+	return bc.dump()
+}
+
+// sealRecovery seals the data key for a member with the member's master key
+func (vf *vaultFile) sealRecovery(member *vaultMember, dataKey []byte, masterKey []byte, masterSalt []byte) error {
+	var err error
+	member.Recovery, err = crypter.Seal(dataKey, masterKey, masterSalt, vf.recoveryContext())
+	return err
+}
+
+func (vf *vaultFile) hasRecovery(name string) bool {
+	for _, member := range vf.Members {
+		if member.Name == name && member.Recovery != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// recover opens the recovery key of the named member with the master password
+// and decrypts the vault contents with the recovered data key. Only the member's
+// own recovery key is tried, so knowing another member's password doesn't let
+// anyone take over their membership.
+func (vf *vaultFile) recover(name string, password []byte) (*vaultMember, []byte, []byte, error) {
+	for _, member := range vf.Members {
+		if member.Name != name || member.Recovery == nil {
+			continue
+		}
+		salt, err := crypter.Salt(member.Recovery)
+		if err != nil {
+			continue
+		}
+		key := crypter.DeriveKey(password, salt)
+		dataKey, context, err := crypter.Open(member.Recovery, key)
+		secmem.Wipe(key)
+		if err != nil {
+			continue
+		}
+		if !bytes.Equal(context, vf.recoveryContext()) {
+			secmem.Wipe(dataKey)
+			continue
+		}
+		data, err := vf.decrypt(dataKey)
+		if err != nil {
+			secmem.Wipe(dataKey)
+			continue
+		}
+		return member, data, dataKey, nil
+	}
+	return nil, nil, nil, errNotVaultMember
+}
+
+// seal encrypts data with the data key bound to the vault context
+// and wraps the key for every vault member
+func (vf *vaultFile) seal(data []byte, dataKey []byte) error {
+	var err error
+	vf.Version = vaultVersion
+
+	for _, member := range vf.Members {
+		member.WrappedKey, err = crypter.WrapKey(dataKey, member.PublicKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	vf.Data, err = crypter.EncryptWithKeyAD(data, dataKey, vf.context())
+	return err
+}
@@ -0,0 +1,191 @@
+package manager
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/viert/yanpassword/crypter"
+)
+
+type testMember struct {
+	public  []byte
+	private []byte
+}
+
+func newTestMember(t *testing.T) testMember {
+	t.Helper()
+	public, private, err := crypter.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testMember{public, private}
+}
+
+// sealTestVault seals the payload for the members and reparses the dump
+// the way it's loaded from Yandex.Disk
+func sealTestVault(t *testing.T, vf *vaultFile, payload []byte, dataKey []byte) *vaultFile {
+	t.Helper()
+	err := vf.seal(payload, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := vf.dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseVaultFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestVaultSealOpen(t *testing.T) {
+	alice, bob, eve := newTestMember(t), newTestMember(t), newTestMember(t)
+	dataKey, err := crypter.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := newVaultID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vf := &vaultFile{
+		ID:       id,
+		Revision: 3,
+		Members: []*vaultMember{
+			{Name: "alice", PublicKey: alice.public},
+			{Name: "bob", PublicKey: bob.public},
+		},
+	}
+	vf = sealTestVault(t, vf, []byte("payload"), dataKey)
+
+	for _, member := range []testMember{alice, bob} {
+		data, key, err := vf.open(member.public, member.private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "payload" || !bytes.Equal(key, dataKey) {
+			t.Errorf("opened %q with key %x", data, key)
+		}
+	}
+
+	_, _, err = vf.open(eve.public, eve.private)
+	if err != errNotVaultMember {
+		t.Errorf("opening by a non-member returned %v, want %v", err, errNotVaultMember)
+	}
+	// a non-member can't use a member's public key either
+	if _, _, err = vf.open(alice.public, eve.private); err == nil {
+		t.Error("vault opened with a wrong private key")
+	}
+}
+
+func TestVaultContextMismatch(t *testing.T) {
+	alice := newTestMember(t)
+	dataKey, err := crypter.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vf := &vaultFile{
+		ID:       "vault",
+		Revision: 3,
+		Members:  []*vaultMember{{Name: "alice", PublicKey: alice.public}},
+	}
+	vf = sealTestVault(t, vf, []byte("payload"), dataKey)
+
+	for _, tamper := range []func(*vaultFile){
+		func(vf *vaultFile) { vf.Revision = 2 },
+		func(vf *vaultFile) { vf.ID = "another vault" },
+	} {
+		tampered := *vf
+		tamper(&tampered)
+		if _, _, err := tampered.open(alice.public, alice.private); err == nil {
+			t.Errorf("vault %s revision %d opened with the context changed", tampered.ID, tampered.Revision)
+		}
+	}
+}
+
+func TestVaultRecovery(t *testing.T) {
+	m, cleanup := newAuthTestManager(t)
+	defer cleanup()
+
+	self, other := newTestMember(t), newTestMember(t)
+	m.webdavAuthData.PublicKey = self.public
+	m.members = []*vaultMember{
+		{Name: "other", PublicKey: other.public},
+		{Name: "user", PublicKey: self.public},
+	}
+	vf := &vaultFile{ID: m.vaultID, Revision: 1, Members: m.members}
+	err := m.updateRecovery(vf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.members[0].Recovery != nil || m.members[1].Recovery == nil {
+		t.Fatal("the recovery key isn't sealed for the current user only")
+	}
+	// the other member happens to share the master password
+	err = vf.sealRecovery(m.members[0], m.dataKey.Bytes(), m.masterKey.Bytes(), m.masterSalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vf = sealTestVault(t, vf, []byte("payload"), m.dataKey.Bytes())
+
+	if _, _, _, err = vf.recover("user", []byte("wrong password")); err != errNotVaultMember {
+		t.Errorf("recovery with a wrong password returned %v", err)
+	}
+
+	// the recovery key doesn't open a vault with another id
+	stolen := &vaultFile{
+		ID:       "another vault",
+		Revision: 1,
+		Members:  []*vaultMember{{Name: "user", PublicKey: self.public, Recovery: vf.Members[1].Recovery}},
+	}
+	stolen = sealTestVault(t, stolen, []byte("payload"), m.dataKey.Bytes())
+	if _, _, _, err = stolen.recover("user", m.masterPassword.Bytes()); err != errNotVaultMember {
+		t.Errorf("recovery key of another vault returned %v", err)
+	}
+
+	// the auth data is lost and a new key pair is generated
+	m.webdavAuthData.Username = "user"
+	m.webdavAuthData.PublicKey = newTestMember(t).public
+	data, dataKey, err := m.recoverVault(vf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "payload" || !bytes.Equal(dataKey, m.dataKey.Bytes()) {
+		t.Fatalf("recovered %q with key %x", data, dataKey)
+	}
+	if !bytes.Equal(vf.Members[1].PublicKey, m.webdavAuthData.PublicKey) {
+		t.Error("the recovered member hasn't got the new public key")
+	}
+	if !bytes.Equal(vf.Members[0].PublicKey, other.public) {
+		t.Error("the recovery took over another member sharing the password")
+	}
+
+	m.config.DisablePasswordRecovery = true
+	err = m.updateRecovery(vf)
+	if err != nil || vf.Members[1].Recovery != nil {
+		t.Errorf("recovery key kept with password recovery disabled, %v", err)
+	}
+}
+
+func TestMemberRemoveDropsRecovery(t *testing.T) {
+	m := newTestManager(t)
+	self, other, removed := newTestMember(t), newTestMember(t), newTestMember(t)
+	m.webdavAuthData.PublicKey = self.public
+	m.members = []*vaultMember{
+		{Name: "user", PublicKey: self.public, Recovery: []byte("self")},
+		{Name: "other", PublicKey: other.public, Recovery: []byte("other")},
+		{Name: "removed", PublicKey: removed.public, Recovery: []byte("removed")},
+	}
+
+	m.memberRemove("removed")
+	if len(m.members) != 2 {
+		t.Fatalf("%d members left, want 2", len(m.members))
+	}
+	if m.members[0].Recovery == nil || m.members[1].Recovery != nil {
+		t.Error("recovery keys of other members kept after rekeying")
+	}
+}
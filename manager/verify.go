@@ -0,0 +1,271 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/viert/yanpassword/client"
+	"github.com/viert/yanpassword/crypter"
+	"github.com/viert/yanpassword/secmem"
+	"github.com/viert/yanpassword/term"
+)
+
+// verifyResult describes the state of a single passdb or backup file
+type verifyResult struct {
+	filename    string
+	format      string
+	generation  string
+	revision    int64
+	entries     int
+	attachments int
+	err         error
+}
+
+// verifier keeps older master passwords prompted during verification
+// so that every legacy backup doesn't require typing them again
+type verifier struct {
+	m         *Manager
+	cli       *client.PassdbClient
+	passwords [][]byte
+	// blobs are attachment verification results by blob ids,
+	// backups usually share most of the attachments
+	blobs map[string]error
+}
+
+func (v *verifier) wipe() {
+	for _, passwd := range v.passwords {
+		secmem.Wipe(passwd)
+	}
+	v.passwords = nil
+}
+
+func (m *Manager) doVerify(name string, argsLine string, args ...string) {
+	cli := client.NewPassdbClient(m.webdavAuthData.Username, m.webdavAuthData.Password)
+	v := &verifier{m: m, cli: cli, blobs: make(map[string]error)}
+	defer v.wipe()
+
+	results := make([]*verifyResult, 0)
+	for _, filename := range cli.Filenames() {
+		data, err := cli.LoadFile(filename)
+		if err != nil {
+			if client.Is404(err) {
+				continue
+			}
+			results = append(results, &verifyResult{filename: filename, err: err})
+			continue
+		}
+		results = append(results, v.verify(filename, data))
+	}
+
+	if len(results) == 0 {
+		term.Warnf("No remote data found\n")
+		return
+	}
+
+	failed := 0
+	for _, res := range results {
+		filename := path.Base(res.filename)
+		if res.err != nil {
+			failed++
+			fmt.Printf("%-10s %s\n", filename, term.Red(res.err.Error()))
+			continue
+		}
+		fmt.Printf(
+			"%-10s %s, revision %d, key generation %s, %d entries, %d attachments\n",
+			filename,
+			res.format,
+			res.revision,
+			res.generation,
+			res.entries,
+			res.attachments,
+		)
+	}
+
+	if failed > 0 {
+		term.Errorf("%d of %d files are not readable\n", failed, len(results))
+	} else {
+		term.Successf("All %d files are readable\n", len(results))
+	}
+}
+
+func (v *verifier) verify(filename string, data []byte) *verifyResult {
+	res := &verifyResult{filename: filename}
+
+	if isVaultFile(data) {
+		res.err = v.verifyVault(res, data)
+	} else if crypter.IsLegacy(data) {
+		res.format = "legacy"
+		res.generation = "master password"
+		res.err = v.verifyLegacy(res, data)
+	} else {
+		res.err = errors.New("unknown file format")
+	}
+	return res
+}
+
+func (v *verifier) verifyVault(res *verifyResult, data []byte) error {
+	vf, err := parseVaultFile(data)
+	if err != nil {
+		return err
+	}
+	res.format = fmt.Sprintf("vault v%d", vf.Version)
+	res.generation = fmt.Sprintf("%d", vf.Generation)
+	res.revision = vf.Revision
+
+	decrypted, dataKey, err := vf.open(v.m.webdavAuthData.PublicKey, v.m.privateKey.Bytes())
+	if err != nil {
+		return err
+	}
+	defer secmem.Wipe(decrypted)
+	defer secmem.Wipe(dataKey)
+
+	if vf.Version < 2 {
+		res.entries, err = verifyPlainData(decrypted)
+		return err
+	}
+
+	idx, schema, err := parseIndex(decrypted, vf.Version)
+	if err != nil {
+		return err
+	}
+	res.format += fmt.Sprintf(" schema %d", schema)
+
+	names := make(map[string]bool)
+	for k, si := range idx.Entries {
+		err = verifyEntryID(k, si)
+		if err != nil {
+			return err
+		}
+		if names[si.Name] {
+			return fmt.Errorf("duplicate service name %s", si.Name)
+		}
+		names[si.Name] = true
+		if si.Secret == nil {
+			return fmt.Errorf("service %s has no secret", k)
+		}
+		secret, err := si.Secret.open(dataKey)
+		if err != nil {
+			return fmt.Errorf("error decrypting service %s: %s", k, err)
+		}
+		for _, att := range si.Attachments {
+			err = v.verifyAttachment(vf.ID, att, secret)
+			if err != nil {
+				return fmt.Errorf("service %s attachment %s: %s", si.Name, att.Name, err)
+			}
+			res.attachments++
+		}
+	}
+	for _, si := range idx.Trash {
+		_, err = si.Secret.open(dataKey)
+		if err != nil {
+			return fmt.Errorf("error decrypting deleted service %s: %s", si.Name, err)
+		}
+	}
+	res.entries = len(idx.Entries)
+	return nil
+}
+
+func (v *verifier) verifyAttachment(vaultID string, att *attachment, secret *serviceSecret) error {
+	key, found := secret.AttachmentKeys[att.BlobID]
+	if !found {
+		return errors.New("no blob key")
+	}
+
+	if err, found := v.blobs[att.BlobID]; found {
+		return err
+	}
+
+	blob, err := v.cli.LoadAttachment(att.BlobID)
+	if err == nil {
+		var data []byte
+		data, err = openAttachment(blob, key, vaultID, att.BlobID)
+		if err == nil && int64(len(data)) != att.Size {
+			err = fmt.Errorf("size mismatch, %d bytes expected, %d found", att.Size, len(data))
+		}
+		secmem.Wipe(data)
+	}
+	v.blobs[att.BlobID] = err
+	return err
+}
+
+func (v *verifier) verifyLegacy(res *verifyResult, data []byte) error {
+	if v.m.config.RefuseLegacyCrypto {
+		return errLegacyRefused
+	}
+
+	for _, passwd := range v.passwords {
+		decrypted, usedMD5, err := crypter.DecryptLegacy(data, passwd)
+		if err == nil {
+			defer secmem.Wipe(decrypted)
+			if usedMD5 {
+				res.format = "legacy MD5"
+			}
+			res.entries, err = verifyPlainData(decrypted)
+			return err
+		}
+	}
+
+	for {
+		prompt := fmt.Sprintf("Master Password for %s (empty to skip): ", path.Base(res.filename))
+		passwd, err := v.m.rl.ReadPassword(prompt)
+		if err != nil {
+			return err
+		}
+		if len(passwd) == 0 {
+			return errors.New("skipped, no valid master password")
+		}
+
+		decrypted, usedMD5, err := crypter.DecryptLegacy(data, passwd)
+		if err != nil {
+			secmem.Wipe(passwd)
+			term.Errorf("Error decrypting %s: %s\n", path.Base(res.filename), err)
+			continue
+		}
+		defer secmem.Wipe(decrypted)
+
+		v.passwords = append(v.passwords, passwd)
+		if usedMD5 {
+			res.format = "legacy MD5"
+		}
+		res.entries, err = verifyPlainData(decrypted)
+		return err
+	}
+}
+
+// verifyPlainData validates passdb data predating per-entry encryption
+func verifyPlainData(data []byte) (int, error) {
+	pd := make(plainServiceData)
+	err := json.Unmarshal(data, &pd)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range pd {
+		err = verifyEntryName(k, v.Name)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(pd), nil
+}
+
+func verifyEntryID(key string, si *ServiceInfo) error {
+	if si.ID != key {
+		return fmt.Errorf("service %s with id %s is stored under key %s", si.Name, si.ID, key)
+	}
+	if si.Name == "" {
+		return fmt.Errorf("service %s has no name", key)
+	}
+	return nil
+}
+
+func verifyEntryName(key string, name string) error {
+	if name == "" {
+		return fmt.Errorf("service %s has no name", key)
+	}
+	if name != key {
+		return fmt.Errorf("service %s is stored under key %s", name, key)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package passgen
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Character classes
+const (
+	LowerChars     = "abcdefghijklmnopqrstuvwxyz"
+	UpperChars     = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	DigitChars     = "0123456789"
+	SymbolChars    = "!#$%&()*+,-./:;<=>?@[]^_{|}~"
+	AmbiguousChars = "Il1|O0o`'\""
+
+	DefaultLength    = 20
+	DefaultSeparator = "-"
+	MinLength        = 4
+	MaxLength        = 1024
+	MaxWords         = 64
+)
+
+// Policy describes passwords to generate. A policy with Words set
+// generates diceware passphrases, otherwise random character passwords.
+type Policy struct {
+	Length           int    `json:"length,omitempty"`
+	Lower            bool   `json:"lower"`
+	Upper            bool   `json:"upper"`
+	Digits           bool   `json:"digits"`
+	Symbols          bool   `json:"symbols"`
+	ExcludeAmbiguous bool   `json:"exclude_ambiguous,omitempty"`
+	RequireEach      bool   `json:"require_each,omitempty"`
+	Words            int    `json:"words,omitempty"`
+	Separator        string `json:"separator,omitempty"`
+}
+
+// DefaultPolicy returns a policy of 20 characters of all classes
+// with at least one character of each class
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Length:      DefaultLength,
+		Lower:       true,
+		Upper:       true,
+		Digits:      true,
+		Symbols:     true,
+		RequireEach: true,
+	}
+}
+
+func (p *Policy) isPassphrase() bool {
+	return p.Words > 0
+}
+
+// classes returns the character classes enabled by the policy
+func (p *Policy) classes() []string {
+	classes := make([]string, 0, 4)
+	for _, class := range []struct {
+		enabled bool
+		chars   string
+	}{
+		{p.Lower, LowerChars},
+		{p.Upper, UpperChars},
+		{p.Digits, DigitChars},
+		{p.Symbols, SymbolChars},
+	} {
+		if !class.enabled {
+			continue
+		}
+		chars := class.chars
+		if p.ExcludeAmbiguous {
+			chars = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(AmbiguousChars, r) {
+					return -1
+				}
+				return r
+			}, chars)
+		}
+		classes = append(classes, chars)
+	}
+	return classes
+}
+
+// Validate checks if passwords can be generated with the policy
+func (p *Policy) Validate() error {
+	if p.isPassphrase() {
+		if p.Words > MaxWords {
+			return fmt.Errorf("a passphrase can't have more than %d words", MaxWords)
+		}
+		return nil
+	}
+
+	if p.Length < MinLength || p.Length > MaxLength {
+		return fmt.Errorf("password length must be from %d to %d", MinLength, MaxLength)
+	}
+	classes := p.classes()
+	if len(classes) == 0 {
+		return errors.New("at least one character class is required")
+	}
+	if p.RequireEach && p.Length < len(classes) {
+		return fmt.Errorf("password length must be at least %d to include every character class", len(classes))
+	}
+	return nil
+}
+
+// Entropy returns the password strength in bits
+func (p *Policy) Entropy() float64 {
+	if p.isPassphrase() {
+		return float64(p.Words) * math.Log2(float64(len(wordlist)))
+	}
+	return float64(p.Length) * math.Log2(float64(len(strings.Join(p.classes(), ""))))
+}
+
+func (p *Policy) String() string {
+	if p.isPassphrase() {
+		return fmt.Sprintf("%d words separated by %q", p.Words, p.separator())
+	}
+
+	parts := []string{fmt.Sprintf("%d characters", p.Length)}
+	for _, class := range []struct {
+		enabled bool
+		name    string
+	}{
+		{p.Lower, "lower"},
+		{p.Upper, "upper"},
+		{p.Digits, "digits"},
+		{p.Symbols, "symbols"},
+	} {
+		if class.enabled {
+			parts = append(parts, class.name)
+		}
+	}
+	if p.ExcludeAmbiguous {
+		parts = append(parts, "no ambiguous")
+	}
+	if p.RequireEach {
+		parts = append(parts, "each class required")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (p *Policy) separator() string {
+	if p.Separator == "" {
+		return DefaultSeparator
+	}
+	return p.Separator
+}
+
+// randInt returns a uniformly distributed random number in [0, n)
+func randInt(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64()), nil
+}
+
+// Generate generates a password or a passphrase according to the policy
+func Generate(p *Policy) (string, error) {
+	err := p.Validate()
+	if err != nil {
+		return "", err
+	}
+	if p.isPassphrase() {
+		return passphrase(p.Words, p.separator())
+	}
+
+	classes := p.classes()
+	all := strings.Join(classes, "")
+	password := make([]byte, 0, p.Length)
+
+	if p.RequireEach {
+		for _, chars := range classes {
+			i, err := randInt(len(chars))
+			if err != nil {
+				return "", err
+			}
+			password = append(password, chars[i])
+		}
+	}
+	for len(password) < p.Length {
+		i, err := randInt(len(all))
+		if err != nil {
+			return "", err
+		}
+		password = append(password, all[i])
+	}
+
+	// Fisher-Yates shuffle so that the required characters
+	// don't always go first
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randInt(i + 1)
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
+
+func passphrase(words int, separator string) (string, error) {
+	chosen := make([]string, words)
+	for i := range chosen {
+		n, err := randInt(len(wordlist))
+		if err != nil {
+			return "", err
+		}
+		chosen[i] = wordlist[n]
+	}
+	return strings.Join(chosen, separator), nil
+}
@@ -0,0 +1,31 @@
+//go:build linux
+// +build linux
+
+package secmem
+
+import (
+	"syscall"
+)
+
+const (
+	madvDontDump = 0x10
+)
+
+func dontDump(mem []byte) {
+	syscall.Madvise(mem, madvDontDump)
+}
+
+// Harden disables core dumps and makes the process non-dumpable
+// so that other processes of the same user can't ptrace it
+func Harden() error {
+	err := syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{Cur: 0, Max: 0})
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_DUMPABLE, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package secmem
+
+import (
+	"syscall"
+)
+
+func dontDump(mem []byte) {}
+
+// Harden disables core dumps
+func Harden() error {
+	return syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{Cur: 0, Max: 0})
+}
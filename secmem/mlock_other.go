@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package secmem
+
+func mlock(mem []byte) error {
+	return nil
+}
+
+func munlock(mem []byte) error {
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package secmem
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func mlock(mem []byte) error {
+	return unix.Mlock(mem)
+}
+
+func munlock(mem []byte) error {
+	return unix.Munlock(mem)
+}
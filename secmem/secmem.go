@@ -0,0 +1,81 @@
+// Package secmem keeps key material in locked memory and wipes it after use
+package secmem
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+var (
+	// OnLockError is called the first time a buffer can't be locked,
+	// e.g. if RLIMIT_MEMLOCK is too low for the key material
+	OnLockError func(err error)
+	lockErrOnce sync.Once
+)
+
+// Buffer is a fixed-size chunk of memory allocated outside of the Go heap.
+// The memory is locked to prevent it from being swapped out and is
+// excluded from core dumps where the platform allows it.
+type Buffer struct {
+	data []byte
+}
+
+// Wipe overwrites b with zeroes
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// New allocates a new locked buffer of a given size. Locking is best effort,
+// a buffer is still returned if the memlock limit doesn't allow locking it.
+func New(size int) (*Buffer, error) {
+	pageSize := os.Getpagesize()
+	allocSize := (size/pageSize + 1) * pageSize
+
+	mem, err := syscall.Mmap(-1, 0, allocSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	err = mlock(mem)
+	if err != nil && OnLockError != nil {
+		lockErrOnce.Do(func() { OnLockError(err) })
+	}
+	dontDump(mem)
+
+	return &Buffer{data: mem[:size]}, nil
+}
+
+// NewFrom moves src into a new locked buffer, src is wiped
+func NewFrom(src []byte) (*Buffer, error) {
+	b, err := New(len(src))
+	if err != nil {
+		Wipe(src)
+		return nil, err
+	}
+	copy(b.data, src)
+	Wipe(src)
+	return b, nil
+}
+
+// Bytes returns the buffer contents. The returned slice must not be
+// retained after the buffer is destroyed.
+func (b *Buffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+// Destroy wipes the buffer and releases its memory
+func (b *Buffer) Destroy() {
+	if b == nil || b.data == nil {
+		return
+	}
+	mem := b.data[:cap(b.data)]
+	Wipe(mem)
+	munlock(mem)
+	syscall.Munmap(mem)
+	b.data = nil
+}
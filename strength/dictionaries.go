@@ -0,0 +1,79 @@
+package strength
+
+// commonPasswords supplement frequentPasswords with passwords popular
+// in newer breach compilations, the most popular first
+var commonPasswords = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234", "111111",
+	"1234567", "dragon", "123123", "baseball", "abc123", "football", "monkey", "letmein",
+	"696969", "shadow", "master", "666666", "qwertyuiop", "123321", "mustang", "1234567890",
+	"michael", "654321", "superman", "1qaz2wsx", "7777777", "121212", "000000", "qazwsx",
+	"123qwe", "killer", "trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter",
+	"buster", "soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"2000", "charlie", "robert", "thomas", "hockey", "ranger", "daniel", "starwars",
+	"klaster", "112233", "george", "computer", "michelle", "jessica", "pepper", "1111",
+	"zxcvbn", "555555", "11111111", "131313", "freedom", "777777", "pass", "maggie",
+	"159753", "aaaaaa", "ginger", "princess", "joshua", "cheese", "amanda", "summer",
+	"love", "ashley", "nicole", "chelsea", "biteme", "matthew", "access", "yankees",
+	"987654321", "dallas", "austin", "thunder", "taylor", "matrix", "mobilemail", "mom",
+	"monitor", "monitoring", "montana", "moon", "moscow", "welcome", "passw0rd", "admin",
+	"qwerty123", "password1", "123abc", "hello", "login", "solo", "starwars1", "flower",
+	"hottie", "loveme", "zaq1zaq1", "password123", "qwe123", "q1w2e3r4", "1q2w3e4r",
+	"1q2w3e", "q1w2e3r4t5", "1q2w3e4r5t", "asdf", "asdfghjkl", "secret", "whatever",
+	"football1", "baseball1", "abcdef", "abcd1234", "test", "test123", "guest", "root",
+	"toor", "changeme", "default", "administrator", "p@ssw0rd", "p@ssword", "pa55word",
+	"letmein1", "welcome1", "monkey1", "dragon1", "qwertyui", "azerty", "iloveyou1",
+	"princess1", "sunshine1", "shadow1", "master1", "michael1", "superman1", "batman1",
+	"trustno1!", "hello123", "charlie1", "aa123456", "donald", "qwerty1", "1qaz2wsx3edc",
+	"zaq12wsx", "samsung", "apple", "google", "yandex", "linkedin", "facebook", "twitter",
+	"internet", "mypass", "mypassword", "nothing", "unknown", "blahblah", "fuckyou",
+	"asshole", "babygirl", "lovely", "angel", "jesus", "blessed", "heaven", "loveyou",
+	"forever", "hannah", "jasmine", "killer1", "lakers", "liverpool", "arsenal", "chelsea1",
+	"barcelona", "madrid", "juventus", "spiderman", "pokemon", "naruto", "minecraft",
+	"corvette", "ferrari", "porsche", "mercedes", "camaro", "gandalf", "merlin", "matrix1",
+	"cookie", "chocolate", "banana", "orange", "purple", "silver", "golden", "diamond",
+	"winter", "spring", "autumn", "october", "november", "december", "january", "february",
+	"qwertz", "qwerty12", "zxcvbnm1", "asdfasdf", "qweasd", "qweasdzxc", "1qazxsw2",
+	"q1w2e3", "a1b2c3", "a1b2c3d4", "abc12345", "abcde", "12qwaszx", "123654", "147258369",
+	"147258", "159357", "741852963", "11223344", "12341234", "123123123", "696969696",
+	"88888888", "99999999", "00000000", "12121212", "987654", "4321", "54321", "0987654321",
+	"troubador",
+}
+
+// englishWords supplement the frequency lists with words and names
+// people base passwords on, the most frequent first
+var englishWords = []string{
+	"the", "you", "and", "that", "this", "what", "have", "for", "not", "are",
+	"with", "your", "just", "was", "know", "but", "can", "all", "get", "like",
+	"here", "there", "right", "out", "about", "now", "one", "come", "want", "think",
+	"good", "well", "time", "yes", "how", "look", "man", "can't", "love", "going",
+	"sorry", "back", "tell", "why", "need", "never", "really", "something",
+	"nothing", "sure", "thank", "thanks", "great", "little", "life", "please", "people",
+	"world", "money", "home", "house", "girl", "girls", "boy", "boys", "baby", "family",
+	"friend", "friends", "mother", "father", "brother", "sister", "daddy", "mommy",
+	"happy", "hello", "dream", "dreams", "magic", "power", "music", "dance", "party",
+	"summer", "winter", "spring", "sunny", "sunday", "monday", "friday", "night", "light",
+	"dark", "black", "white", "blue", "green", "red", "yellow", "pink", "purple", "orange",
+	"star", "stars", "moon", "sun", "sky", "sea", "ocean", "river", "water", "fire",
+	"earth", "wind", "storm", "rain", "snow", "ice", "stone", "rock", "gold", "silver",
+	"king", "queen", "prince", "princess", "lord", "god", "angel", "devil", "demon", "ghost",
+	"hero", "warrior", "knight", "dragon", "tiger", "lion", "eagle", "wolf", "bear", "shark",
+	"snake", "horse", "monkey", "rabbit", "bunny", "kitty", "puppy", "doggy", "cat", "dog",
+	"fish", "bird", "apple", "banana", "cherry", "lemon", "peach", "sugar", "honey", "candy",
+	"cookie", "coffee", "pizza", "cheese", "butter", "bread", "beer", "wine", "whiskey",
+	"soccer", "football", "baseball", "hockey", "tennis", "golf", "game", "games", "player",
+	"winner", "secret", "private", "secure", "security", "system", "server", "admin",
+	"master", "login", "access", "account", "office", "work", "school", "college", "student",
+	"teacher", "doctor", "computer", "internet", "network", "phone", "mobile", "email",
+	"welcome", "freedom", "liberty", "justice", "peace", "faith", "hope", "trust", "forever",
+	"always", "beautiful", "pretty", "sweet", "sexy", "hot", "cool", "crazy", "lucky",
+	"smile", "heart", "kiss", "darling", "lover", "sweetheart", "flower", "rose",
+	"lily", "daisy", "garden", "holiday", "travel", "paris", "london", "berlin",
+	"moscow", "tokyo", "america", "russia", "england", "france", "germany", "canada",
+	"john", "james", "robert", "michael", "william", "david", "richard", "joseph", "thomas",
+	"charles", "daniel", "matthew", "anthony", "mark", "paul", "steven", "andrew", "kevin",
+	"brian", "george", "edward", "peter", "alex", "alexander", "max", "sam", "jack", "harry",
+	"mary", "patricia", "jennifer", "linda", "elizabeth", "barbara", "susan", "jessica",
+	"sarah", "karen", "nancy", "lisa", "anna", "maria", "emma", "olivia", "sophia", "julia",
+	"kate", "helen", "natasha", "olga", "irina", "elena", "ivan", "sergey", "dmitry", "andrey",
+	"viktor", "nikolay", "vladimir", "pavel", "oleg", "igor", "maxim", "denis", "artem",
+}
@@ -0,0 +1,682 @@
+package strength
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/viert/yanpassword/secmem"
+)
+
+// Scores
+const (
+	VeryWeak = iota
+	Weak
+	Fair
+	Good
+	Strong
+)
+
+const (
+	// maxAnalyzed limits the pattern analysis, the rest of
+	// a longer password counts as random characters
+	maxAnalyzed = 100
+	minWordLen  = 3
+	minPattern  = 3
+	// matchPenalty is added for every pattern combined into a password
+	matchPenalty = 1.0
+
+	minYear      = 1000
+	maxYear      = 2050
+	minYearSpace = 20
+
+	keyboardStarts = 94
+	keyboardDegree = 4.6
+)
+
+// scoreBits are the minimum guessing entropy of the scores above VeryWeak,
+// they follow zxcvbn thresholds of 10^3, 10^6, 10^8 and 10^10 guesses
+var scoreBits = []float64{10, 20, 26.6, 33.2}
+
+var scoreLabels = []string{"very weak", "weak", "fair", "good", "strong"}
+
+// Result is the password strength estimate
+type Result struct {
+	// Bits is the estimated guessing entropy, log2 of the number of guesses
+	// an attacker aware of common patterns needs to find the password
+	Bits     float64
+	Score    int
+	Warnings []string
+}
+
+// Label returns the human readable score
+func (r *Result) Label() string {
+	return scoreLabels[r.Score]
+}
+
+// match is a part of the password recognized as a guessable pattern
+type match struct {
+	start   int
+	end     int
+	bits    float64
+	warning string
+}
+
+type entry struct {
+	rank    int
+	warning string
+}
+
+var dictionary = buildDictionary()
+
+func buildDictionary() map[string]entry {
+	dict := make(map[string]entry)
+	// a word found in several lists keeps its best rank
+	add := func(words []string, warning string) {
+		for i, word := range words {
+			if e, found := dict[word]; !found || e.rank > i+1 {
+				dict[word] = entry{i + 1, warning}
+			}
+		}
+	}
+	add(strings.Split(frequentPasswords, "\n"), "This is a commonly used password")
+	add(commonPasswords, "This is a commonly used password")
+	add(strings.Split(englishFrequency, "\n"), "Words are easy to guess")
+	add(englishWords, "Words and names are easy to guess")
+	add(strings.Split(femaleNames, "\n"), "Names and surnames are easy to guess")
+	add(strings.Split(maleNames, "\n"), "Names and surnames are easy to guess")
+	add(strings.Split(surnames, "\n"), "Names and surnames are easy to guess")
+	return dict
+}
+
+// Estimate estimates the password strength. User inputs like the service
+// name or the username are treated as the most likely words.
+func Estimate(password []byte, userInputs ...string) *Result {
+	analyzed := password
+	if utf8.RuneCount(password) > maxAnalyzed {
+		n := 0
+		for i := range string(password) {
+			if n == maxAnalyzed {
+				analyzed = password[:i]
+				break
+			}
+			n++
+		}
+	}
+
+	cardinality := charsetCardinality(password)
+	perChar := math.Log2(float64(cardinality))
+
+	matches := findMatches(analyzed, userInputs)
+	bits, path := bestPath(analyzed, matches, perChar)
+	bits += float64(utf8.RuneCount(password[len(analyzed):])) * perChar
+
+	res := &Result{Bits: bits, Warnings: make([]string, 0)}
+	for res.Score < Strong && bits >= scoreBits[res.Score] {
+		res.Score++
+	}
+
+	if res.Score >= Good {
+		// patterns found in strong passwords don't matter
+		return res
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range path {
+		if m.warning != "" && !seen[m.warning] {
+			seen[m.warning] = true
+			res.Warnings = append(res.Warnings, m.warning)
+		}
+	}
+	if len(path) == 1 && path[0].start == 0 && path[0].end == len(analyzed) {
+		res.Warnings = append(res.Warnings, "A single pattern is easy to guess, add a few more words or characters")
+	}
+	if utf8.RuneCount(password) < 8 {
+		res.Warnings = append(res.Warnings, "Short passwords are easy to guess")
+	}
+	return res
+}
+
+// charsetCardinality returns the number of characters in the
+// character classes the password uses
+func charsetCardinality(password []byte) int {
+	var lower, upper, digits, symbols, other bool
+	for _, r := range string(password) {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digits = true
+		case r < utf8.RuneSelf:
+			symbols = true
+		default:
+			other = true
+		}
+	}
+
+	n := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digits, 10}, {symbols, 33}, {other, 100}} {
+		if class.used {
+			n += class.size
+		}
+	}
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// bestPath finds the cheapest way to guess the password combining
+// matched patterns and random characters
+func bestPath(password []byte, matches []*match, perChar float64) (float64, []*match) {
+	n := len(password)
+	best := make([]float64, n+1)
+	via := make([]*match, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = math.Inf(1)
+	}
+
+	byEnd := make(map[int][]*match)
+	for _, m := range matches {
+		byEnd[m.end] = append(byEnd[m.end], m)
+	}
+
+	for i := 1; i <= n; i++ {
+		// a random character, continuation bytes of multibyte
+		// characters come for free
+		cost := perChar
+		if !utf8.RuneStart(password[i-1]) {
+			cost = 0
+		}
+		best[i] = best[i-1] + cost
+		via[i] = nil
+
+		for _, m := range byEnd[i] {
+			bits := best[m.start] + m.bits + matchPenalty
+			if bits < best[i] {
+				best[i] = bits
+				via[i] = m
+			}
+		}
+	}
+
+	path := make([]*match, 0)
+	for i := n; i > 0; {
+		if m := via[i]; m != nil {
+			path = append(path, m)
+			i = m.start
+		} else {
+			i--
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return best[n], path
+}
+
+func findMatches(password []byte, userInputs []string) []*match {
+	// patterns are ascii so only ascii letters are lowercased
+	lower := make([]byte, len(password))
+	defer secmem.Wipe(lower)
+	for i, c := range password {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+
+	matches := make([]*match, 0)
+	matches = append(matches, dictionaryMatches(password, lower, userInputs)...)
+	matches = append(matches, keyboardMatches(password)...)
+	matches = append(matches, sequenceMatches(password)...)
+	matches = append(matches, repeatMatches(password)...)
+	matches = append(matches, dateMatches(password)...)
+	return matches
+}
+
+var leetTables = []map[byte]byte{
+	{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+		'0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+	{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'l', '|': 'l',
+		'0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+}
+
+func dictionaryMatches(password []byte, lower []byte, userInputs []string) []*match {
+	// user inputs take precedence over the dictionary, they are looked up
+	// separately so that the large dictionary is never copied
+	inputs := make(map[string]entry, len(userInputs))
+	for i, input := range userInputs {
+		input = strings.ToLower(input)
+		if len(input) >= minWordLen {
+			inputs[input] = entry{i + 1, "Passwords based on the service name or the username are easy to guess"}
+		}
+	}
+	lookup := func(word []byte) (entry, bool) {
+		if e, found := inputs[string(word)]; found {
+			return e, true
+		}
+		e, found := dictionary[string(word)]
+		return e, found
+	}
+
+	n := len(lower)
+	matches := make([]*match, 0)
+	reversed := make([]byte, n)
+	unleeted := make([]byte, n)
+	defer secmem.Wipe(reversed)
+	defer secmem.Wipe(unleeted)
+
+	for i := 0; i < n; i++ {
+		for j := i + minWordLen; j <= n; j++ {
+			word := lower[i:j]
+			variations := caseVariations(password[i:j])
+
+			if e, found := lookup(word); found {
+				matches = append(matches, &match{i, j, math.Log2(float64(e.rank)) + variations, e.warning})
+			}
+
+			rev := reversed[:j-i]
+			for k := range word {
+				rev[k] = word[len(word)-1-k]
+			}
+			if e, found := lookup(rev); found {
+				matches = append(matches, &match{i, j, math.Log2(float64(e.rank)) + variations + 1, e.warning})
+			}
+
+			for _, table := range leetTables {
+				plain := unleeted[:j-i]
+				subs := 0
+				for k, c := range word {
+					if p, found := table[c]; found {
+						plain[k] = p
+						subs++
+					} else {
+						plain[k] = c
+					}
+				}
+				if subs == 0 {
+					continue
+				}
+				if e, found := lookup(plain); found {
+					warning := e.warning + ", predictable substitutions like @ for a don't help much"
+					bits := math.Log2(float64(e.rank)) + variations + float64(subs)
+					matches = append(matches, &match{i, j, bits, warning})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// caseVariations returns bits added by capitalization of a word,
+// capitalizing the first letter or all the letters adds just one
+func caseVariations(word []byte) float64 {
+	upper, lower := 0, 0
+	for _, c := range word {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper++
+		case c >= 'a' && c <= 'z':
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 0
+	}
+	first := word[0] >= 'A' && word[0] <= 'Z'
+	last := word[len(word)-1] >= 'A' && word[len(word)-1] <= 'Z'
+	if lower == 0 || (upper == 1 && (first || last)) {
+		return 1
+	}
+
+	variations := 0.0
+	for k := 1; k <= upper && k <= lower; k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return math.Log2(variations)
+}
+
+func binomial(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r *= float64(n)
+		r /= float64(d)
+		n--
+	}
+	return r
+}
+
+type keyPosition struct {
+	row     int
+	x       int
+	shifted bool
+}
+
+// keyboardRows are qwerty rows, x positions are in half key widths
+// so that the rows are staggered the way they are on the keyboard
+var keyboardRows = []struct {
+	stagger   int
+	unshifted string
+	shifted   string
+}{
+	{0, "`1234567890-=", "~!@#$%^&*()_+"},
+	{3, "qwertyuiop[]\\", "QWERTYUIOP{}|"},
+	{4, "asdfghjkl;'", "ASDFGHJKL:\""},
+	{5, "zxcvbnm,./", "ZXCVBNM<>?"},
+}
+
+var keyboard = buildKeyboard()
+
+func buildKeyboard() map[byte]keyPosition {
+	kb := make(map[byte]keyPosition)
+	for row, r := range keyboardRows {
+		for col := 0; col < len(r.unshifted); col++ {
+			x := r.stagger + 2*col
+			kb[r.unshifted[col]] = keyPosition{row, x, false}
+			kb[r.shifted[col]] = keyPosition{row, x, true}
+		}
+	}
+	return kb
+}
+
+// keyDirection returns the direction from key a to key b if they're adjacent
+func keyDirection(a, b keyPosition) (int, bool) {
+	dr, dx := b.row-a.row, b.x-a.x
+	if (dr == 0 && (dx == 2 || dx == -2)) || ((dr == 1 || dr == -1) && (dx == 1 || dx == -1)) {
+		return dr*10 + dx, true
+	}
+	return 0, false
+}
+
+func keyboardMatches(password []byte) []*match {
+	matches := make([]*match, 0)
+	n := len(password)
+	for i := 0; i < n-1; {
+		j := i + 1
+		turns := 0
+		dir := 0
+		shifted := 0
+		if p, found := keyboard[password[i]]; found && p.shifted {
+			shifted++
+		}
+		for ; j < n; j++ {
+			a, foundA := keyboard[password[j-1]]
+			b, foundB := keyboard[password[j]]
+			if !foundA || !foundB {
+				break
+			}
+			d, adjacent := keyDirection(a, b)
+			if !adjacent {
+				break
+			}
+			if d != dir {
+				turns++
+				dir = d
+			}
+			if b.shifted {
+				shifted++
+			}
+		}
+
+		if j-i >= minPattern {
+			warning := "Short keyboard patterns are easy to guess"
+			if turns == 1 {
+				warning = "Straight rows of keys are easy to guess"
+			}
+			bits := keyboardBits(j-i, turns, shifted)
+			matches = append(matches, &match{i, j, bits, warning})
+		}
+		i = j
+	}
+	return matches
+}
+
+// keyboardBits follows zxcvbn estimation of keyboard walks of the length
+// with the number of turns and shifted keys
+func keyboardBits(length int, turns int, shifted int) float64 {
+	guesses := 0.0
+	for i := 2; i <= length; i++ {
+		for j := 1; j <= turns && j <= i-1; j++ {
+			guesses += binomial(i-1, j-1) * keyboardStarts * math.Pow(keyboardDegree, float64(j))
+		}
+	}
+
+	unshifted := length - shifted
+	if shifted > 0 {
+		if unshifted == 0 {
+			guesses *= 2
+		} else {
+			variations := 0.0
+			for i := 1; i <= shifted && i <= unshifted; i++ {
+				variations += binomial(length, i)
+			}
+			guesses *= variations
+		}
+	}
+	return math.Log2(guesses)
+}
+
+func charClass(c byte) int {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return 1
+	case c >= 'A' && c <= 'Z':
+		return 2
+	case c >= '0' && c <= '9':
+		return 3
+	default:
+		return 0
+	}
+}
+
+func sequenceMatches(password []byte) []*match {
+	matches := make([]*match, 0)
+	n := len(password)
+	for i := 0; i < n-1; {
+		class := charClass(password[i])
+		delta := int(password[i+1]) - int(password[i])
+		j := i + 1
+		if class != 0 && (delta == 1 || delta == -1) {
+			for j < n && charClass(password[j]) == class && int(password[j])-int(password[j-1]) == delta {
+				j++
+			}
+		}
+
+		if j-i >= minPattern {
+			var base float64
+			switch first := password[i]; {
+			case strings.IndexByte("aAzZ019", first) >= 0:
+				base = 4
+			case class == 3:
+				base = 10
+			default:
+				base = 26
+			}
+			if delta < 0 {
+				base *= 2
+			}
+			bits := math.Log2(base * float64(j-i))
+			matches = append(matches, &match{i, j, bits, "Sequences like abc or 6543 are easy to guess"})
+			i = j - 1
+			continue
+		}
+		i++
+	}
+	return matches
+}
+
+func repeatMatches(password []byte) []*match {
+	matches := make([]*match, 0)
+	n := len(password)
+	for i := 0; i < n; i++ {
+		for l := 1; i+2*l <= n; l++ {
+			base := password[i : i+l]
+			count := 1
+			for i+(count+1)*l <= n && string(password[i+count*l:i+(count+1)*l]) == string(base) {
+				count++
+			}
+			if count < 2 || count*l < minPattern {
+				continue
+			}
+
+			var baseBits float64
+			if l == 1 {
+				baseBits = math.Log2(float64(charsetCardinality(base)))
+			} else {
+				baseBits = Estimate(base).Bits
+			}
+			bits := baseBits + math.Log2(float64(count))
+			matches = append(matches, &match{i, i + count*l, bits, "Repeats like aaa or abcabc are easy to guess"})
+		}
+	}
+	return matches
+}
+
+func isDigits(s []byte) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+func atoi(s []byte) int {
+	n := 0
+	for _, c := range s {
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
+
+// yearSpace returns the number of years between the year and now
+// but not less than minYearSpace
+func yearSpace(year int) float64 {
+	space := time.Now().Year() - year
+	if space < 0 {
+		space = -space
+	}
+	if space < minYearSpace {
+		space = minYearSpace
+	}
+	return float64(space)
+}
+
+// fullYear expands two digits years, the year must have either 2 or 4 digits
+func fullYear(s []byte) (int, bool) {
+	switch len(s) {
+	case 2:
+		year := atoi(s)
+		if year > 50 {
+			return 1900 + year, true
+		}
+		return 2000 + year, true
+	case 4:
+		year := atoi(s)
+		return year, year >= minYear && year <= maxYear
+	default:
+		return 0, false
+	}
+}
+
+// validDate checks the day, month and year parts of a date
+func validDate(day, month, year []byte) (int, bool) {
+	d, m := atoi(day), atoi(month)
+	if len(day) > 2 || len(month) > 2 || d < 1 || d > 31 || m < 1 || m > 12 {
+		return 0, false
+	}
+	return fullYear(year)
+}
+
+// parseDate parses digits and separators as a date in any of the
+// popular day, month and year orders
+func parseDate(s []byte) (int, bool) {
+	var parts [][]byte
+	separated := false
+	for _, sep := range []byte(" /\\_.-") {
+		if strings.Count(string(s), string(sep)) == 2 {
+			parts = splitBytes(s, sep)
+			separated = true
+			break
+		}
+	}
+	if !separated {
+		if !isDigits(s) {
+			return 0, false
+		}
+		switch len(s) {
+		case 6:
+			parts = [][]byte{s[:2], s[2:4], s[4:]}
+		case 8:
+			if year, ok := validDate(s[6:], s[4:6], s[:4]); ok {
+				return year, true
+			}
+			parts = [][]byte{s[:2], s[2:4], s[4:]}
+		default:
+			return 0, false
+		}
+	}
+
+	for _, p := range parts {
+		if !isDigits(p) {
+			return 0, false
+		}
+	}
+	// day-month-year, month-day-year, year-month-day
+	for _, order := range [][3]int{{0, 1, 2}, {1, 0, 2}, {2, 1, 0}} {
+		if year, ok := validDate(parts[order[0]], parts[order[1]], parts[order[2]]); ok {
+			return year, true
+		}
+	}
+	return 0, false
+}
+
+func splitBytes(s []byte, sep byte) [][]byte {
+	parts := make([][]byte, 0, 3)
+	start := 0
+	for i, c := range s {
+		if c == sep {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func dateMatches(password []byte) []*match {
+	matches := make([]*match, 0)
+	n := len(password)
+	const warning = "Dates and years are easy to guess"
+
+	for i := 0; i+4 <= n; i++ {
+		if year := password[i : i+4]; isDigits(year) {
+			y := atoi(year)
+			if y >= minYear && y <= maxYear {
+				matches = append(matches, &match{i, i + 4, math.Log2(yearSpace(y)), warning})
+			}
+		}
+
+		for j := i + 6; j <= n && j <= i+10; j++ {
+			year, ok := parseDate(password[i:j])
+			if !ok {
+				continue
+			}
+			guesses := 365 * yearSpace(year)
+			if !isDigits(password[i:j]) {
+				guesses *= 4
+			}
+			matches = append(matches, &match{i, j, math.Log2(guesses), warning})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,47 @@
+package strength
+
+import "testing"
+
+func TestEstimateScores(t *testing.T) {
+	for _, tc := range []struct {
+		password string
+		score    int
+	}{
+		{"password", VeryWeak},
+		{"P@ssw0rd", VeryWeak},
+		{"qwerty", VeryWeak},
+		{"drowssap", VeryWeak},
+		{"aaaaaaaaaa", VeryWeak},
+		{"abcdef123456", VeryWeak},
+		{"12/05/1987", Weak},
+		{"correcthorsebatterystaple", Strong},
+		{"x9$Lq2!vR7#m", Strong},
+		// the xkcd example, a l33t dictionary word with a suffix
+		{"Tr0ub4dor&3", Fair},
+		{"zimmerman", VeryWeak},
+		{"troubadour", Weak},
+	} {
+		res := Estimate([]byte(tc.password))
+		if res.Score != tc.score {
+			t.Errorf("%s: score %d (%.1f bits), want %d", tc.password, res.Score, res.Bits, tc.score)
+		}
+	}
+}
+
+func TestEstimateUserInputs(t *testing.T) {
+	pwd := []byte("megacorp2024")
+	without := Estimate(pwd)
+	with := Estimate(pwd, "megacorp")
+	if with.Bits >= without.Bits {
+		t.Errorf("user input doesn't lower the estimate: %.1f bits with, %.1f without", with.Bits, without.Bits)
+	}
+}
+
+func TestEstimateWarnings(t *testing.T) {
+	if res := Estimate([]byte("password")); len(res.Warnings) == 0 {
+		t.Error("no warnings for a common password")
+	}
+	if res := Estimate([]byte("x9$Lq2!vR7#m")); len(res.Warnings) != 0 {
+		t.Errorf("warnings for a strong password: %v", res.Warnings)
+	}
+}
@@ -0,0 +1,207 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported HMAC algorithms
+const (
+	SHA1   = "SHA1"
+	SHA256 = "SHA256"
+	SHA512 = "SHA512"
+
+	// DefaultDigits is the code length used when not set explicitly
+	DefaultDigits = 6
+	// DefaultPeriod is the code lifetime in seconds used when not set explicitly
+	DefaultPeriod = 30
+)
+
+var (
+	// ErrEmptySecret is returned when a key has no secret
+	ErrEmptySecret = errors.New("TOTP secret is empty")
+
+	b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// Key is a TOTP key along with its parameters
+type Key struct {
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	Period    int
+	Issuer    string
+	Account   string
+}
+
+// Parse parses an otpauth:// URI or a base32-encoded secret
+func Parse(input string) (*Key, error) {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(strings.ToLower(input), "otpauth://") {
+		return ParseURI(input)
+	}
+	secret, err := decodeSecret(input)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{Secret: secret, Algorithm: SHA1, Digits: DefaultDigits, Period: DefaultPeriod}, nil
+}
+
+// ParseURI parses an otpauth://totp/ URI as used by Google Authenticator
+func ParseURI(uri string) (*Key, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(u.Scheme) != "otpauth" {
+		return nil, fmt.Errorf("invalid otpauth URI scheme %s", u.Scheme)
+	}
+	if strings.ToLower(u.Host) != "totp" {
+		return nil, fmt.Errorf("unsupported OTP type %s, only totp is supported", u.Host)
+	}
+
+	q := u.Query()
+	secret, err := decodeSecret(q.Get("secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Key{Secret: secret, Algorithm: SHA1, Digits: DefaultDigits, Period: DefaultPeriod}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if idx := strings.Index(label, ":"); idx >= 0 {
+		k.Issuer = strings.TrimSpace(label[:idx])
+		k.Account = strings.TrimSpace(label[idx+1:])
+	} else {
+		k.Account = label
+	}
+	if issuer := q.Get("issuer"); issuer != "" {
+		k.Issuer = issuer
+	}
+
+	if alg := q.Get("algorithm"); alg != "" {
+		k.Algorithm = strings.ToUpper(alg)
+	}
+	if digits := q.Get("digits"); digits != "" {
+		k.Digits, err = strconv.Atoi(digits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digits value %s", digits)
+		}
+	}
+	if period := q.Get("period"); period != "" {
+		k.Period, err = strconv.Atoi(period)
+		if err != nil {
+			return nil, fmt.Errorf("invalid period value %s", period)
+		}
+	}
+
+	err = k.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	secret = strings.TrimRight(secret, "=")
+	if secret == "" {
+		return nil, ErrEmptySecret
+	}
+	data, err := b32.DecodeString(secret)
+	if err != nil {
+		return nil, errors.New("TOTP secret is not valid base32")
+	}
+	return data, nil
+}
+
+// Validate checks the key parameters
+func (k *Key) Validate() error {
+	if len(k.Secret) == 0 {
+		return ErrEmptySecret
+	}
+	if k.hash() == nil {
+		return fmt.Errorf("unsupported algorithm %s, valid algorithms are SHA1, SHA256 and SHA512", k.Algorithm)
+	}
+	if k.Digits != 6 && k.Digits != 8 {
+		return fmt.Errorf("unsupported number of digits %d, only 6 and 8 are supported", k.Digits)
+	}
+	if k.Period <= 0 {
+		return fmt.Errorf("invalid period %d", k.Period)
+	}
+	return nil
+}
+
+func (k *Key) hash() func() hash.Hash {
+	switch k.Algorithm {
+	case SHA1:
+		return sha1.New
+	case SHA256:
+		return sha256.New
+	case SHA512:
+		return sha512.New
+	default:
+		return nil
+	}
+}
+
+// Code generates the code valid at the given time
+func (k *Key) Code(t time.Time) (string, error) {
+	err := k.Validate()
+	if err != nil {
+		return "", err
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix())/uint64(k.Period))
+
+	mac := hmac.New(k.hash(), k.Secret)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation as defined in RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < k.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", k.Digits, value%mod), nil
+}
+
+// Remaining returns the time left until the code generated at t expires
+func (k *Key) Remaining(t time.Time) time.Duration {
+	period := int64(k.Period)
+	return time.Duration(period-t.Unix()%period) * time.Second
+}
+
+// URI returns the key as an otpauth:// URI
+func (k *Key) URI() string {
+	q := url.Values{}
+	q.Set("secret", b32.EncodeToString(k.Secret))
+	if k.Issuer != "" {
+		q.Set("issuer", k.Issuer)
+	}
+	q.Set("algorithm", k.Algorithm)
+	q.Set("digits", strconv.Itoa(k.Digits))
+	q.Set("period", strconv.Itoa(k.Period))
+
+	label := k.Account
+	if k.Issuer != "" {
+		label = k.Issuer + ":" + k.Account
+	}
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + label, RawQuery: q.Encode()}
+	return u.String()
+}
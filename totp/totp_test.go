@@ -0,0 +1,116 @@
+package totp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// rfc6238Seeds are the RFC 6238 Appendix B keys, the 20 byte ASCII seed
+// repeated up to the HMAC block size of every algorithm
+var rfc6238Seeds = map[string]string{
+	SHA1:   "12345678901234567890",
+	SHA256: "12345678901234567890123456789012",
+	SHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+}
+
+// rfc6238Vectors are the RFC 6238 Appendix B test vectors
+var rfc6238Vectors = []struct {
+	unix  int64
+	codes map[string]string
+}{
+	{59, map[string]string{SHA1: "94287082", SHA256: "46119246", SHA512: "90693936"}},
+	{1111111109, map[string]string{SHA1: "07081804", SHA256: "68084774", SHA512: "25091201"}},
+	{1111111111, map[string]string{SHA1: "14050471", SHA256: "67062674", SHA512: "99943326"}},
+	{1234567890, map[string]string{SHA1: "89005924", SHA256: "91819424", SHA512: "93441116"}},
+	{2000000000, map[string]string{SHA1: "69279037", SHA256: "90698825", SHA512: "38618901"}},
+	{20000000000, map[string]string{SHA1: "65353130", SHA256: "77737706", SHA512: "47863826"}},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		now := time.Unix(v.unix, 0)
+		for algorithm, want := range v.codes {
+			k := &Key{Secret: []byte(rfc6238Seeds[algorithm]), Algorithm: algorithm, Digits: 8, Period: 30}
+			code, err := k.Code(now)
+			if err != nil {
+				t.Fatalf("%s at %d: %s", algorithm, v.unix, err)
+			}
+			if code != want {
+				t.Errorf("%s at %d: got %s, want %s", algorithm, v.unix, code, want)
+			}
+			if remaining := k.Remaining(now); remaining != time.Duration(30-v.unix%30)*time.Second {
+				t.Errorf("%s at %d: %s remaining", algorithm, v.unix, remaining)
+			}
+		}
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	k, err := ParseURI("otpauth://totp/ACME%20Co:john@example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=sha256&digits=8&period=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Key{
+		Secret:    []byte("12345678901234567890"),
+		Algorithm: SHA256,
+		Digits:    8,
+		Period:    60,
+		Issuer:    "ACME Co",
+		Account:   "john@example.com",
+	}
+	if !reflect.DeepEqual(k, want) {
+		t.Errorf("parsed %+v, want %+v", k, want)
+	}
+
+	// the issuer parameter takes precedence over the label prefix
+	k, err = ParseURI("otpauth://totp/Old:john?secret=GEZDGNBV&issuer=New")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Issuer != "New" || k.Account != "john" || k.Algorithm != SHA1 || k.Digits != DefaultDigits || k.Period != DefaultPeriod {
+		t.Errorf("parsed %+v", k)
+	}
+
+	for _, uri := range []string{
+		"otpauth://hotp/john?secret=GEZDGNBV&counter=1",
+		"http://totp/john?secret=GEZDGNBV",
+		"otpauth://totp/john",
+		"otpauth://totp/john?secret=not-base32",
+		"otpauth://totp/john?secret=GEZDGNBV&algorithm=MD5",
+		"otpauth://totp/john?secret=GEZDGNBV&digits=7",
+		"otpauth://totp/john?secret=GEZDGNBV&period=0",
+	} {
+		if _, err = ParseURI(uri); err == nil {
+			t.Errorf("%s accepted", uri)
+		}
+	}
+}
+
+func TestParseSecret(t *testing.T) {
+	k, err := Parse(" gezd gnbv gy3t qojq gezd gnbv gy3t qojq== ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(k.Secret) != "12345678901234567890" || k.Algorithm != SHA1 || k.Digits != DefaultDigits || k.Period != DefaultPeriod {
+		t.Errorf("parsed %+v", k)
+	}
+	if _, err = Parse("  "); err != ErrEmptySecret {
+		t.Errorf("empty secret returned %v, want %v", err, ErrEmptySecret)
+	}
+}
+
+func TestURIRoundTrip(t *testing.T) {
+	for _, k := range []*Key{
+		{Secret: []byte("12345678901234567890"), Algorithm: SHA512, Digits: 8, Period: 60, Issuer: "ACME Co", Account: "john@example.com"},
+		{Secret: []byte("secret"), Algorithm: SHA1, Digits: 6, Period: 30, Account: "john"},
+	} {
+		parsed, err := Parse(k.URI())
+		if err != nil {
+			t.Fatalf("%s: %s", k.URI(), err)
+		}
+		if !reflect.DeepEqual(parsed, k) {
+			t.Errorf("%s parsed as %+v, want %+v", k.URI(), parsed, k)
+		}
+	}
+}